@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// redditTokenFile is where -authorize saves the refresh token
+const redditTokenFile = "reddit_refresh_token.txt"
+
+// loadRefreshToken returns REDDIT_REFRESH_TOKEN if set, otherwise the token
+// saved by -authorize
+func loadRefreshToken(cfg *syncer.Config) (string, error) {
+	if cfg.RefreshToken != "" {
+		return cfg.RefreshToken, nil
+	}
+	data, err := os.ReadFile(redditTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s (run with -authorize or set REDDIT_REFRESH_TOKEN): %w", redditTokenFile, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", redditTokenFile)
+	}
+	return token, nil
+}
+
+// One-time: Run this to get a refresh token
+func getRedditRefreshToken(clientID, authBaseURL string, transport http.RoundTripper) (string, error) {
+	oauth2Config := reddit.NewOAuthConfig(clientID, authBaseURL)
+	fmt.Printf("DEBUG: Using clientID=%q, redirectURI=%q\n", clientID, reddit.RedirectURI)
+	state := fmt.Sprintf("%d", rand.Int())
+	authURL := oauth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	fmt.Println("Go to the following URL in your browser and authorize the app:")
+	fmt.Println(authURL)
+
+	codeCh := make(chan string)
+	srv := &http.Server{Addr: ":8080"}
+	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		receivedState := r.URL.Query().Get("state")
+		code := r.URL.Query().Get("code")
+		fmt.Printf("DEBUG: Received callback with state=%q, code=%q\n", receivedState, code)
+		if receivedState != state {
+			http.Error(w, "State mismatch", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "Authorization successful! You can close this window.")
+		codeCh <- code
+		go srv.Shutdown(context.Background())
+	})
+	go func() { _ = srv.ListenAndServe() }()
+	code := <-codeCh
+
+	fmt.Printf("DEBUG: Exchanging code: %q\n", code)
+	ctx := reddit.OAuthContext(context.Background(), transport, reddit.DefaultTimeout)
+	token, err := oauth2Config.Exchange(ctx, code)
+	if err != nil {
+		fmt.Printf("DEBUG: Exchange error: %v\n", err)
+		return "", fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+	return token.RefreshToken, nil
+}
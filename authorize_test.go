@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// inTempDir runs the test in an empty directory, where -authorize would
+// save the token file
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLoadRefreshToken(t *testing.T) {
+	inTempDir(t)
+
+	if _, err := loadRefreshToken(&syncer.Config{}); err == nil {
+		t.Error("loadRefreshToken succeeded without a token")
+	}
+	if err := os.WriteFile(redditTokenFile, []byte("  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRefreshToken(&syncer.Config{}); err == nil {
+		t.Error("loadRefreshToken accepted an empty token file")
+	}
+
+	if err := os.WriteFile(redditTokenFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadRefreshToken(&syncer.Config{}); err != nil || got != "from-file" {
+		t.Errorf("loadRefreshToken() = %q, %v, want the saved token", got, err)
+	}
+	// REDDIT_REFRESH_TOKEN wins over the file
+	if got, err := loadRefreshToken(&syncer.Config{RefreshToken: "from-env"}); err != nil || got != "from-env" {
+		t.Errorf("loadRefreshToken() = %q, %v, want REDDIT_REFRESH_TOKEN", got, err)
+	}
+}
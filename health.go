@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// Health tracks the outcome of sync cycles for the /readyz endpoint
+type Health struct {
+	// MaxFailures is how many consecutive failed cycles make the process
+	// unready again, 0 means never
+	MaxFailures int
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastError   error
+	failures    int
+}
+
+// Record notes the outcome of one sync cycle
+func (h *Health) Record(s syncer.Summary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.Err != nil {
+		h.failures++
+		h.lastError = s.Err
+		return
+	}
+	h.failures = 0
+	h.lastError = nil
+	h.lastSuccess = s.Started.Add(s.Duration)
+}
+
+// ready reports whether a cycle succeeded and the failures since stay
+// below MaxFailures, along with a description of the state
+func (h *Health) ready() (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastSuccess.IsZero() {
+		if h.lastError != nil {
+			return false, fmt.Sprintf("no successful sync cycle yet, last error: %v", h.lastError)
+		}
+		return false, "no successful sync cycle yet"
+	}
+	since := "last successful sync cycle " + h.lastSuccess.UTC().Format(time.RFC3339)
+	if h.MaxFailures > 0 && h.failures >= h.MaxFailures {
+		return false, fmt.Sprintf("%d consecutive sync cycles failed, %s, last error: %v", h.failures, since, h.lastError)
+	}
+	return true, since
+}
+
+// Handler serves /healthz, which always answers 200 while the process
+// runs, and /readyz, which answers 503 until a sync cycle succeeds
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ok, state := h.ready()
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintln(w, state)
+	})
+	return mux
+}
+
+// ServeHealth serves the health check and metrics handler on port until
+// ctx is done
+func ServeHealth(ctx context.Context, port int, handler http.Handler) error {
+	ln, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen for health checks: %w", err)
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Health check server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving health checks", "port", port)
+	return nil
+}
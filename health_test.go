@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// probe requests path from handler and returns the status and body
+func probe(handler http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealthTransitions(t *testing.T) {
+	health := &Health{MaxFailures: 2}
+	handler := health.Handler()
+	failed := syncer.Summary{Err: errors.New("Reddit is down")}
+	succeeded := syncer.Summary{Started: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Duration: time.Second}
+
+	steps := []struct {
+		name    string
+		record  *syncer.Summary
+		status  int
+		message string
+	}{
+		{"before the first cycle", nil, http.StatusServiceUnavailable, "no successful sync cycle yet"},
+		{"after a failed first cycle", &failed, http.StatusServiceUnavailable, "last error: Reddit is down"},
+		{"after a success", &succeeded, http.StatusOK, "2024-05-01T12:00:01Z"},
+		{"after one failure", &failed, http.StatusOK, "2024-05-01T12:00:01Z"},
+		{"after MaxFailures failures", &failed, http.StatusServiceUnavailable, "2 consecutive sync cycles failed"},
+		{"after recovering", &succeeded, http.StatusOK, "last successful sync cycle"},
+	}
+	for _, step := range steps {
+		if step.record != nil {
+			health.Record(*step.record)
+		}
+		status, body := probe(handler, "/readyz")
+		if status != step.status || !strings.Contains(body, step.message) {
+			t.Errorf("%s: /readyz = %d %q, want %d with %q", step.name, status, body, step.status, step.message)
+		}
+		if status, _ := probe(handler, "/healthz"); status != http.StatusOK {
+			t.Errorf("%s: /healthz = %d, want 200", step.name, status)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package cassette records HTTP interactions with secrets scrubbed and
+// replays them from a test server, so API clients can be tested against
+// real response shapes without credentials.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Redacted replaces secrets in recorded interactions. Tests replaying a
+// cassette use it as their token, so requests still match.
+const Redacted = "REDACTED"
+
+// Request is the part of a recorded request that is matched on replay.
+// Query and Form only list the parameters that must match; Body, when set,
+// is JSON whose fields must all appear in the request body.
+type Request struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Query  map[string]string `json:"query,omitempty"`
+	Form   map[string]string `json:"form,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response is a recorded response. A Body that is a JSON string is sent
+// as its text, e.g. an HTML page, anything else as the JSON itself.
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Interaction is a request and the response it got
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is a sequence of interactions, replayed in order
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Load reads a cassette from a JSON file, typically under testdata
+func Load(filename string) (*Cassette, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", filename, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to a JSON file
+func (c *Cassette) Save(filename string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// Replay loads the cassette file and serves it from a test server that is
+// closed with the test. Every request must match the next interaction, and
+// all interactions must have been used by the end of the test.
+func Replay(t *testing.T, filename string) *httptest.Server {
+	t.Helper()
+	c, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	next := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(c.Interactions) {
+			t.Errorf("%s: unexpected request %s %s after the last interaction", filename, r.Method, r.URL)
+			http.Error(w, "cassette exhausted", http.StatusNotImplemented)
+			return
+		}
+		interaction := c.Interactions[next]
+		next++
+		if err := match(interaction.Request, r); err != nil {
+			t.Errorf("%s: interaction %d: %v", filename, next, err)
+		}
+		write(w, interaction.Response)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		if next < len(c.Interactions) {
+			t.Errorf("%s: only %d of %d interactions were used", filename, next, len(c.Interactions))
+		}
+	})
+	return srv
+}
+
+// match reports how r differs from the recorded request
+func match(want Request, r *http.Request) error {
+	if r.Method != want.Method || r.URL.Path != want.Path {
+		return fmt.Errorf("got %s %s, want %s %s", r.Method, r.URL.Path, want.Method, want.Path)
+	}
+	query := r.URL.Query()
+	for name, value := range want.Query {
+		if got := query.Get(name); got != value {
+			return fmt.Errorf("query %s = %q, want %q", name, got, value)
+		}
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(want.Form) > 0 {
+		form, err := neturl.ParseQuery(string(body))
+		if err != nil {
+			return fmt.Errorf("failed to parse form: %w", err)
+		}
+		for name, value := range want.Form {
+			if got := form.Get(name); got != value {
+				return fmt.Errorf("form %s = %q, want %q", name, got, value)
+			}
+		}
+	}
+	if len(want.Body) > 0 {
+		var wantBody, gotBody interface{}
+		if err := json.Unmarshal(want.Body, &wantBody); err != nil {
+			return fmt.Errorf("failed to decode recorded body: %w", err)
+		}
+		if err := json.Unmarshal(body, &gotBody); err != nil {
+			return fmt.Errorf("failed to decode request body %s: %w", body, err)
+		}
+		if !contains(gotBody, wantBody) {
+			return fmt.Errorf("request body %s does not contain %s", body, want.Body)
+		}
+	}
+	return nil
+}
+
+// contains reports whether got has every object field of want with an equal
+// value. Arrays must have the same length and match element by element.
+func contains(got, want interface{}) bool {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range want {
+			if !contains(got[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok || len(got) != len(want) {
+			return false
+		}
+		for i := range want {
+			if !contains(got[i], want[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return got == want
+	}
+}
+
+// write sends a recorded response
+func write(w http.ResponseWriter, resp Response) {
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+	body := []byte(resp.Body)
+	var text string
+	if json.Unmarshal(resp.Body, &text) == nil {
+		body = []byte(text)
+	} else if w.Header().Get("Content-Type") == "" && len(body) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Recorder is a RoundTripper that records the interactions it passes on
+// to Transport, replacing each of Secrets with Redacted. Headers other
+// than Content-Type and the rate limit ones are left out, since they may
+// carry credentials.
+type Recorder struct {
+	Transport http.RoundTripper
+	Secrets   []string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// recordedHeaders are the response headers worth replaying
+var recordedHeaders = []string{"Content-Type", "Retry-After", "X-Ratelimit-Remaining", "X-Ratelimit-Reset", "X-Ratelimit-Used"}
+
+// RoundTrip implements http.RoundTripper
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	transport := rec.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recorded := Interaction{
+		Request: Request{Method: req.Method, Path: req.URL.Path},
+		Response: Response{
+			Status: resp.StatusCode,
+			Body:   rec.rawBody(respBody),
+		},
+	}
+	if query := req.URL.Query(); len(query) > 0 {
+		recorded.Request.Query = rec.flatten(query)
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := neturl.ParseQuery(string(reqBody)); err == nil {
+			recorded.Request.Form = rec.flatten(form)
+		}
+	} else if len(reqBody) > 0 {
+		recorded.Request.Body = rec.rawBody(reqBody)
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if recorded.Response.Headers == nil {
+				recorded.Response.Headers = make(map[string]string)
+			}
+			recorded.Response.Headers[name] = value
+		}
+	}
+	rec.mu.Lock()
+	rec.cassette.Interactions = append(rec.cassette.Interactions, recorded)
+	rec.mu.Unlock()
+	return resp, nil
+}
+
+// Cassette returns the interactions recorded so far
+func (rec *Recorder) Cassette() *Cassette {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	c := Cassette{Interactions: append([]Interaction(nil), rec.cassette.Interactions...)}
+	return &c
+}
+
+// scrub replaces the secrets in s
+func (rec *Recorder) scrub(s string) string {
+	for _, secret := range rec.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+// rawBody scrubs a body and keeps it as JSON when it is JSON, otherwise as
+// a JSON string
+func (rec *Recorder) rawBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	scrubbed := rec.scrub(string(body))
+	if json.Valid([]byte(scrubbed)) {
+		return json.RawMessage(scrubbed)
+	}
+	text, _ := json.Marshal(scrubbed)
+	return text
+}
+
+// flatten scrubs the first value of each parameter
+func (rec *Recorder) flatten(values neturl.Values) map[string]string {
+	flat := make(map[string]string, len(values))
+	for name := range values {
+		flat[name] = rec.scrub(values.Get(name))
+	}
+	return flat
+}
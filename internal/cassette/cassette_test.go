@@ -0,0 +1,86 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, `{"_code":"Ok","echo":`+string(body)+`}`)
+	}))
+	defer live.Close()
+
+	rec := &Recorder{Secrets: []string{"secret-token"}}
+	client := &http.Client{Transport: rec}
+	resp, err := client.Post(live.URL+"/file/list?x=1", "application/json", strings.NewReader(`{"token":"secret-token"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "secret-token") {
+		t.Errorf("the caller got a scrubbed response: %s", body)
+	}
+
+	file := filepath.Join(t.TempDir(), "file_list.json")
+	if err := rec.Cassette().Save(file); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.Interactions[0]
+	if strings.Contains(string(got.Request.Body)+string(got.Response.Body), "secret-token") {
+		t.Errorf("secret left in the cassette: %+v", got)
+	}
+	if _, ok := got.Response.Headers["Set-Cookie"]; ok {
+		t.Error("cookie header recorded")
+	}
+	if got.Request.Query["x"] != "1" {
+		t.Errorf("query = %v", got.Request.Query)
+	}
+
+	// Replaying needs the redacted token in place of the real one
+	srv := Replay(t, file)
+	resp, err = http.Post(srv.URL+"/file/list?x=1", "application/json", strings.NewReader(`{"token":"REDACTED","extra":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"REDACTED"`) {
+		t.Errorf("replayed body = %s", body)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	want := Request{
+		Method: "POST",
+		Path:   "/doc/edit",
+		Body:   []byte(`{"file_id":"f","changes":[{"action":"insert","index":0}]}`),
+	}
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"token":"t","file_id":"f","changes":[{"action":"insert","index":0,"content":"x"}]}`, true},
+		{`{"file_id":"f","changes":[{"action":"insert","index":-1}]}`, false},
+		{`{"file_id":"f","changes":[]}`, false},
+		{`{"file_id":"g","changes":[{"action":"insert","index":0}]}`, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/doc/edit", strings.NewReader(tt.body))
+		if err := match(want, r); (err == nil) != tt.ok {
+			t.Errorf("match(%s) = %v, want ok %v", tt.body, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package timeutil holds time helpers shared by the command and the API
+// clients.
+package timeutil
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep waits for d and reports whether it elapsed before ctx was done
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,23 @@
+package timeutil
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	if !Sleep(context.Background(), time.Millisecond) {
+		t.Error("Sleep reported a cancellation without one")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if Sleep(ctx, time.Hour) {
+		t.Error("Sleep elapsed although ctx was done")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Sleep waited %v after ctx was done", waited)
+	}
+}
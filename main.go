@@ -2,295 +2,315 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"log"
-	"math/rand"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"golang.org/x/oauth2"
+	"github.com/korjavin/reddit2dynalist/internal/timeutil"
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
 )
 
-const (
-	redditRedirectURI = "http://localhost:8080/callback"
-	redditTokenFile   = "reddit_refresh_token.txt"
-)
-
-// RedditCredentials contains the credentials needed for Reddit API
-type RedditCredentials struct {
-	ClientID string
-}
-
-// RedditClient handles interactions with the Reddit API
-type RedditClient struct {
-	HTTPClient *http.Client
-	UserAgent  string
-}
-
-// RedditPost represents a saved post or comment from Reddit
-type RedditPost struct {
-	Kind      string  `json:"kind"`
-	ID        string  `json:"id"`
-	FullID    string  `json:"name"`
-	Title     string  `json:"title,omitempty"`
-	Author    string  `json:"author"`
-	Permalink string  `json:"permalink"`
-	URL       string  `json:"url,omitempty"`
-	Created   float64 `json:"created_utc"`
-	IsComment bool    `json:"-"` // Internal field
-}
-
-// RedditResponse represents the response from Reddit API
-type RedditResponse struct {
-	Kind string `json:"kind"`
-	Data struct {
-		Children []struct {
-			Kind string     `json:"kind"`
-			Data RedditPost `json:"data"`
-		} `json:"children"`
-		After string `json:"after"`
-	} `json:"data"`
-}
+func main() {
+	authorize := flag.Bool("authorize", false, "Run OAuth2 authorization flow to get refresh token")
+	plan := flag.Bool("plan", false, "Show which posts would be added to Dynalist without writing anything")
+	once := flag.Bool("once", false, "Run a single sync cycle and exit with a status code describing the outcome")
+	backfill := flag.Bool("backfill", false, "Deliver the whole saved history, like BACKFILL=true; with -once, run cycles until it is done")
+	noNewExitCode := flag.Int("no-new-exit-code", syncer.ExitNoNewPosts, "Exit code used by -once when no new posts were found")
+	showVersion := flag.Bool("version", false, "Print the version, commit and build date and exit")
+	flag.Parse()
 
-// Cache stores post IDs to avoid duplicates
-type Cache struct {
-	Posts map[string]time.Time
-}
+	if *showVersion {
+		fmt.Println(readBuildInfo())
+		return
+	}
 
-// SaveToFile saves the cache to a file
-func (c *Cache) SaveToFile(filename string) error {
-	data, err := json.Marshal(c)
+	cfg, err := syncer.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to marshal cache: %w", err)
+		fatal("Invalid configuration", "error", err)
 	}
-	return os.WriteFile(filename, data, 0644)
-}
+	slog.SetDefault(slog.New(syncer.NewLogHandler(os.Stderr, cfg.LogLevel, cfg.LogFormat)))
+	if *backfill {
+		cfg.Backfill = true
+	}
+	build := readBuildInfo()
+	slog.Info("Starting reddit2dynalist", "version", build.Version, "commit", build.Commit, "built", build.Date)
 
-// LoadCacheFromFile loads the cache from a file
-func LoadCacheFromFile(filename string) (*Cache, error) {
-	cache := &Cache{Posts: make(map[string]time.Time)}
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cache, nil
+	if *authorize {
+		refreshToken, err := getRedditRefreshToken(cfg.ClientID, cfg.RedditAuthBaseURL, syncer.NewTransport(cfg.TLSConfig))
+		if err != nil {
+			fatal("Failed to get refresh token", "error", err)
 		}
-		return nil, fmt.Errorf("failed to read cache file: %w", err)
-	}
-	if err := json.Unmarshal(data, cache); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cache: %w", err)
+		fmt.Printf("Your refresh token (save this!):\n%s\n", refreshToken)
+		if err := os.WriteFile(redditTokenFile, []byte(refreshToken), 0600); err != nil {
+			fatal("Failed to save refresh token", "error", err)
+		}
+		fmt.Println("Refresh token saved to", redditTokenFile)
+		return
 	}
-	return cache, nil
-}
 
-// NewRedditClient creates a new Reddit client using the installed app flow
-func NewRedditClient(clientID, refreshToken string) (*RedditClient, error) {
-	ctx := context.Background()
-	oauth2Config := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: "",
-		RedirectURL:  redditRedirectURI,
-		Scopes:       []string{"history", "identity", "read", "save"},
-		Endpoint: oauth2.Endpoint{
-			TokenURL: "https://www.reddit.com/api/v1/access_token",
-			AuthURL:  "https://www.reddit.com/api/v1/authorize",
-		},
+	refreshToken, err := loadRefreshToken(cfg)
+	if err != nil {
+		fatal("Failed to read refresh token", "error", err)
 	}
-	token := &oauth2.Token{RefreshToken: refreshToken}
-	tokenSource := oauth2Config.TokenSource(ctx, token)
-	httpClient := oauth2.NewClient(ctx, tokenSource)
-	httpClient.Timeout = 30 * time.Second
-	userAgent := "script:reddit2dynalist:v1.0 (by /u/yourusername)" // Change to your Reddit username
-	return &RedditClient{
-		HTTPClient: httpClient,
-		UserAgent:  userAgent,
-	}, nil
-}
 
-// One-time: Run this to get a refresh token
-func getRedditRefreshToken(clientID string) (string, error) {
-	oauth2Config := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: "",
-		RedirectURL:  redditRedirectURI,
-		Scopes:       []string{"history", "identity", "read", "save"},
-		Endpoint: oauth2.Endpoint{
-			TokenURL: "https://www.reddit.com/api/v1/access_token",
-			AuthURL:  "https://www.reddit.com/api/v1/authorize",
-		},
+	if reddit.LooksLikeBrowser(cfg.UserAgent) {
+		slog.Warn("REDDIT_USER_AGENT looks like a web browser's, which Reddit rejects for API clients; "+
+			"use a unique one such as script:<app>:<version> (by /u/<username>)", "user_agent", cfg.UserAgent)
+	}
+	redditClient := newConfiguredRedditClient(cfg, cfg.Username, refreshToken)
+	// One client per account, by lowercase username
+	redditClients := map[string]*reddit.Client{strings.ToLower(cfg.Username): redditClient}
+	for _, account := range cfg.Accounts {
+		redditClients[strings.ToLower(account.Username)] = newConfiguredRedditClient(cfg, account.Username, account.RefreshToken)
 	}
-	fmt.Printf("DEBUG: Using clientID=%q, redirectURI=%q\n", clientID, redditRedirectURI)
-	state := fmt.Sprintf("%d", rand.Int())
-	authURL := oauth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-	fmt.Println("Go to the following URL in your browser and authorize the app:")
-	fmt.Println(authURL)
 
-	codeCh := make(chan string)
-	srv := &http.Server{Addr: ":8080"}
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		receivedState := r.URL.Query().Get("state")
-		code := r.URL.Query().Get("code")
-		fmt.Printf("DEBUG: Received callback with state=%q, code=%q\n", receivedState, code)
-		if receivedState != state {
-			http.Error(w, "State mismatch", http.StatusBadRequest)
-			return
+	if cfg.ClockSkewMax > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		skew, err := reddit.CheckClockSkew(ctx, syncer.NewTransport(cfg.TLSConfig), cfg.RedditAuthBaseURL)
+		cancel()
+		if err != nil {
+			slog.Warn("Could not check clock skew against Reddit", "error", err)
+		} else if skew > cfg.ClockSkewMax || skew < -cfg.ClockSkewMax {
+			msg := "Local clock differs from Reddit's; OAuth token expiry will be miscalculated, check NTP on this host"
+			args := []any{"skew", skew.Round(time.Second), "limit", cfg.ClockSkewMax}
+			if cfg.ClockSkewFatal {
+				fatal(msg, args...)
+			}
+			slog.Warn(msg, args...)
 		}
-		fmt.Fprintf(w, "Authorization successful! You can close this window.")
-		codeCh <- code
-		go srv.Shutdown(context.Background())
-	})
-	go func() { _ = srv.ListenAndServe() }()
-	code := <-codeCh
+	}
 
-	fmt.Printf("DEBUG: Exchanging code: %q\n", code)
-	ctx := context.Background()
-	token, err := oauth2Config.Exchange(ctx, code)
+	jobs, err := syncer.BuildJobs(cfg)
 	if err != nil {
-		fmt.Printf("DEBUG: Exchange error: %v\n", err)
-		return "", fmt.Errorf("failed to exchange code for token: %w", err)
+		fatal("Failed to create sync jobs", "error", err)
 	}
-	return token.RefreshToken, nil
-}
+	defer syncer.CloseJobs(jobs)
+	checkDynalist(jobs)
 
-func (r *RedditClient) GetSavedPosts(ctx context.Context, username string, limit int) ([]RedditPost, error) {
-	url := fmt.Sprintf("https://oauth.reddit.com/user/%s/saved?limit=%d&sort=new", username, limit)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	cacheFile := cfg.CacheFile
+	if !*plan {
+		if err := syncer.PrepareCacheFile(cacheFile); err != nil {
+			fatal("Cache file is not usable, set CACHE_FILE to a writable location", "file", cacheFile, "error", err)
+		}
+		lock, err := syncer.LockCacheFile(cacheFile, cfg.CacheLockWait)
+		if errors.Is(err, syncer.ErrLocked) {
+			fatal("Another instance is using the cache file, stop it or set CACHE_LOCK=wait to wait for it", "file", cacheFile)
+		}
+		if err != nil {
+			fatal("Failed to lock cache file", "file", cacheFile, "error", err)
+		}
+		defer syncer.UnlockCacheFile(lock)
 	}
-	req.Header.Set("User-Agent", r.UserAgent)
-	resp, err := r.HTTPClient.Do(req)
+	cache, err := syncer.LoadCacheFromFile(cacheFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		slog.Warn("Failed to load cache, creating a new cache", "file", cacheFile, "error", err)
+		cache = syncer.NewCache()
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Reddit API error: %s, Body: %s", resp.Status, string(body))
+	cache.Pretty = cfg.CachePretty
+	cache.MaxSize = cfg.CacheMaxSize
+	cache.DedupTTL = cfg.DedupTTL
+	cache.ReadOnly = cfg.DryRun && !cfg.DryRunSaveCache
+	if cfg.DryRun {
+		slog.Info("Dry run: items are logged instead of delivered", "save_cache", cfg.DryRunSaveCache)
 	}
-	var redditResp RedditResponse
-	if err := json.NewDecoder(resp.Body).Decode(&redditResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-	var posts []RedditPost
-	for _, child := range redditResp.Data.Children {
-		post := child.Data
-		post.FullID = child.Kind + "_" + post.ID
-		post.IsComment = (child.Kind == "t1")
-		posts = append(posts, post)
-	}
-	return posts, nil
-}
+	slog.Info("Loaded cache", "posts", cache.Len())
 
-func main() {
-	authorize := flag.Bool("authorize", false, "Run OAuth2 authorization flow to get refresh token")
-	flag.Parse()
+	// From here on every request can be interrupted by Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	clientID := os.Getenv("REDDIT_CLIENT_ID")
-	username := os.Getenv("REDDIT_USERNAME")
-	dynalistKey := os.Getenv("DYNALIST_API_KEY")
-	if clientID == "" || username == "" || dynalistKey == "" {
-		log.Fatal("Missing required environment variables. Please set REDDIT_CLIENT_ID, REDDIT_USERNAME, and DYNALIST_API_KEY")
+	if (cfg.SeedFromDocument || cfg.DocumentLookback > 0) && !*plan {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		for _, job := range jobs {
+			recoverer, ok := job.Sink.(syncer.CacheRecoverer)
+			if !ok || !cfg.SeedFromDocument && !job.FirstRunPending(cache) {
+				continue
+			}
+			n, err := recoverer.Recover(ctx, cache, job.Sink.Name(), cfg.DocumentLookback)
+			if err != nil {
+				slog.Warn("Failed to recover deliveries from the document", "sink", job.Sink.Name(), "error", err)
+				continue
+			}
+			slog.Info("Seeded the cache with posts already in the document", "sink", job.Sink.Name(), "posts", n)
+		}
+		cancel()
 	}
 
-	if *authorize {
-		refreshToken, err := getRedditRefreshToken(clientID)
-		if err != nil {
-			log.Fatalf("Failed to get refresh token: %v", err)
+	if *plan {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		for _, job := range jobs {
+			redditClient := redditClients[strings.ToLower(job.Cfg.Username)]
+			if err := syncer.RunPlan(ctx, redditClient, job, cache, os.Stdout); err != nil {
+				fatal("Failed to build plan", "job", job.Name, "error", err)
+			}
 		}
-		fmt.Printf("Your refresh token (save this!):\n%s\n", refreshToken)
-		if err := os.WriteFile(redditTokenFile, []byte(refreshToken), 0600); err != nil {
-			log.Fatalf("Failed to save refresh token: %v", err)
-		}
-		fmt.Println("Refresh token saved to", redditTokenFile)
 		return
 	}
 
-	refreshTokenBytes, err := os.ReadFile(redditTokenFile)
-	if err != nil {
-		log.Fatalf("Failed to read refresh token file: %v", err)
+	if cfg.StartupDelay > 0 {
+		slog.Info("Waiting before the first sync", "delay", cfg.StartupDelay)
+		if !timeutil.Sleep(ctx, cfg.StartupDelay) {
+			slog.Info("Shutdown requested during startup delay, exiting")
+			return
+		}
 	}
-	refreshToken := string(refreshTokenBytes)
 
-	redditClient, err := NewRedditClient(clientID, refreshToken)
-	if err != nil {
-		log.Fatal("Failed to create Reddit client:", err)
+	health := &Health{MaxFailures: cfg.HealthMaxFailures}
+	var notifier *WebhookNotifier
+	if cfg.WebhookURL != "" {
+		notifier = NewWebhookNotifier(cfg.WebhookURL, syncer.NewTransport(cfg.TLSConfig))
 	}
-
-	cacheFile := "reddit2dynalist.cache.json"
-	cache, err := LoadCacheFromFile(cacheFile)
-	if err != nil {
-		log.Printf("Warning: Failed to load cache: %v. Creating a new cache.", err)
-		cache = &Cache{Posts: make(map[string]time.Time)}
+	// Cycles per Reddit client for AUTH_VERIFY_EVERY, so every account's
+	// token is checked however its jobs interleave with others. Cycles never
+	// overlap, so run updates it without locking.
+	cycles := make(map[*reddit.Client]int)
+	run := func(job *syncer.SyncJob) syncer.Summary {
+		if job.Name != "" {
+			slog.Info("Running sync job", "job", job.Name)
+		}
+		redditClient := redditClients[strings.ToLower(job.Cfg.Username)]
+		started := time.Now()
+		redditBefore, dynalistBefore := reddit.Requests.Load(), dynalist.Requests.Load()
+		var summary syncer.Summary
+		cycles[redditClient]++
+		if cfg.AuthVerifyEvery > 0 && cycles[redditClient]%cfg.AuthVerifyEvery == 0 {
+			verifyCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := redditClient.RecheckAuthentication(verifyCtx, job.Cfg.Username); errors.Is(err, reddit.ErrChallenge) {
+				slog.Warn("Could not verify Reddit authentication", "error", err)
+				redditErrors.Add(1)
+			} else if err != nil {
+				redditErrors.Add(1)
+				slog.Error("Skipping this cycle; run with -authorize if it persists", "error", err)
+				summary.Err = err
+			}
+			cancel()
+		}
+		if summary.Err == nil {
+			summary = syncer.RunCycle(ctx, redditClient, job.Cfg, job.Sink, cache, cacheFile)
+		}
+		summary.Job = job.Name
+		if len(cfg.Accounts) > 0 {
+			summary.Account = job.Cfg.Username
+		}
+		summary.Started = started
+		summary.Duration = time.Since(started)
+		summary.RedditCalls = reddit.Requests.Load() - redditBefore
+		summary.DynalistCalls = dynalist.Requests.Load() - dynalistBefore
+		slog.Debug("Sync cycle finished", "job", job.Name, "duration", summary.Duration,
+			"reddit_calls", summary.RedditCalls, "dynalist_calls", summary.DynalistCalls)
+		if cfg.SummaryOutput != "" {
+			if err := syncer.WriteSummary(cfg.SummaryOutput, summary); err != nil {
+				slog.Warn("Failed to write cycle summary", "error", err)
+			}
+		}
+		postsProcessed.Add(int64(summary.Added))
+		postsFailed.Add(int64(summary.Failed))
+		health.Record(summary)
+		if notifier != nil && !cfg.DryRun {
+			if err := notifier.Notify(ctx, summary); err != nil {
+				slog.Warn("Failed to send webhook notification", "error", err)
+			}
+		}
+		if errors.Is(summary.Err, reddit.ErrInvalidGrant) {
+			fatal("Reddit rejected the refresh token. This happens after a Reddit password change or when the app's access "+
+				"was revoked. Run with -authorize to get a new refresh token, then restart.", "error", reddit.ErrInvalidGrant)
+		}
+		return summary
 	}
-	log.Printf("Loaded cache with %d previously processed posts", len(cache.Posts))
 
-	ticker := time.NewTicker(5 * time.Minute)
-	log.Printf("Starting to check for new saved posts every 5 minutes...")
+	if *once || cfg.RunOnce {
+		var summary syncer.Summary
+		for _, job := range jobs {
+			summary.Add(syncer.RunBackfill(ctx, job, cache, run))
+		}
+		syncer.CloseJobs(jobs)
+		os.Exit(summary.ExitCode(*noNewExitCode))
+	}
 
-	processNewPosts(redditClient, username, dynalistKey, cache, cacheFile)
-	for range ticker.C {
-		processNewPosts(redditClient, username, dynalistKey, cache, cacheFile)
+	var cycleMu sync.Mutex
+	if cfg.HealthPort > 0 {
+		mux := healthMux(health, cache, cfg.TriggerToken, &cycleMu, jobs, run)
+		if err := ServeHealth(ctx, cfg.HealthPort, mux); err != nil {
+			fatal("Failed to start the health check server", "error", err)
+		}
 	}
-}
+	for _, job := range jobs {
+		if job.Name == "" {
+			slog.Info("Starting to check for new saved posts", "interval", job.Interval)
+		} else {
+			slog.Info("Starting sync job", "job", job.Name, "interval", job.Interval)
+		}
+	}
+	syncer.RunJobs(ctx, jobs, &cycleMu, run)
 
-func processNewPosts(
-	redditClient *RedditClient,
-	username string,
-	dynalistKey string,
-	cache *Cache,
-	cacheFile string,
-) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// A cycle cut short by the shutdown saved what it had done, save once
+	// more so nothing recorded since is lost
+	saveCtx, cancel := context.WithTimeout(context.Background(), syncer.CacheSaveTimeout)
 	defer cancel()
+	if err := cache.SaveToFile(saveCtx, cacheFile); err != nil {
+		slog.Warn("Failed to save cache", "file", cacheFile, "error", err)
+	}
+	slog.Info("Shut down cleanly")
+}
 
-	posts, err := redditClient.GetSavedPosts(ctx, username, 25)
+// newConfiguredRedditClient creates a Reddit client for the account with
+// the User-Agent and retry settings of cfg
+func newConfiguredRedditClient(cfg *syncer.Config, username, refreshToken string) *reddit.Client {
+	client, err := reddit.NewClient(cfg.ClientID, refreshToken, syncer.NewTransport(cfg.TLSConfig), cfg.RedditHTTPTimeout)
 	if err != nil {
-		log.Printf("Error fetching saved posts: %v", err)
-		return
+		fatal("Failed to create Reddit client", "error", err)
+	}
+	client.BaseURL = cfg.RedditAPIBaseURL
+	if cfg.RedditAuthBaseURL != reddit.DefaultAuthBaseURL {
+		client.SetAuthBaseURL(cfg.RedditAuthBaseURL)
+	}
+	client.UserAgent = cfg.UserAgent
+	if client.UserAgent == "" {
+		client.UserAgent = reddit.DefaultUserAgent(readBuildInfo().Version, username)
 	}
+	client.SoftLimitRetries = cfg.SoftLimitRetries
+	client.RateLimitRetries = cfg.RateLimitRetries
+	return client
+}
 
-	newPosts := 0
-	for _, post := range posts {
-		if _, exists := cache.Posts[post.FullID]; exists {
+// checkDynalist verifies the Dynalist API key at startup when a job writes
+// to Dynalist, so a bad key is reported now rather than by the first write.
+// A grouping document that is missing and won't be created is warned about.
+func checkDynalist(jobs []*syncer.SyncJob) {
+	for _, job := range jobs {
+		cfg := job.Cfg
+		if cfg.Sink != syncer.SinkDynalist {
 			continue
 		}
-		cache.Posts[post.FullID] = time.Now()
-		var content string
-		if post.IsComment {
-			content = fmt.Sprintf("Comment by %s - https://reddit.com%s", post.Author, post.Permalink)
-		} else if post.Title != "" {
-			content = fmt.Sprintf("%s - https://reddit.com%s", post.Title, post.Permalink)
-		} else {
-			content = fmt.Sprintf("Post by %s - https://reddit.com%s", post.Author, post.Permalink)
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		client := syncer.NewDynalistClient(cfg)
+		err := client.VerifyAPIKey(ctx)
+		if dynalist.IsInvalidToken(err) {
+			fatal("Dynalist rejected DYNALIST_API_KEY; create a new one at https://dynalist.io/developer", "error", err)
 		}
-		title := fmt.Sprintf("Post by %s - https://reddit.com%s", post.Author, post.Permalink)
-		log.Printf("Adding new saved post to Dynalist: %s", content)
-		err = AddToDynalist(dynalistKey, title, content)
 		if err != nil {
-			log.Printf("Error creating Dynalist item: %v", err)
-			continue
+			slog.Warn("Could not check the Dynalist API key", "error", err)
+			return
 		}
-		newPosts++
-	}
-
-	now := time.Now()
-	for id, timestamp := range cache.Posts {
-		if now.Sub(timestamp) > 7*24*time.Hour {
-			delete(cache.Posts, id)
+		grouped := cfg.GroupBy != "" && cfg.GroupBy != syncer.GroupNone
+		if grouped && !cfg.DynalistCreateDocument {
+			var notFound *dynalist.DocumentNotFoundError
+			if _, err := client.FindDocument(ctx, cfg.DynalistDocument, cfg.DynalistDocumentIgnoreCase); errors.As(err, &notFound) {
+				slog.Warn("Items can't be delivered until the document exists", "error", err)
+			}
 		}
-	}
-
-	if newPosts > 0 {
-		log.Printf("Added %d new posts to Dynalist", newPosts)
-	} else {
-		log.Printf("No new posts found")
-	}
-
-	if err := cache.SaveToFile(cacheFile); err != nil {
-		log.Printf("Warning: Failed to save cache: %v", err)
+		// Every job uses the same key
+		return
 	}
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+func TestRedditUserAgent(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/access_token" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"test-access","token_type":"bearer","expires_in":3600}`)
+			return
+		}
+		sent = r.Header.Get("User-Agent")
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[]}}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"generated", "", reddit.DefaultUserAgent(readBuildInfo().Version, "alice")},
+		{"blank", "   ", reddit.DefaultUserAgent(readBuildInfo().Version, "alice")},
+		{"configured", "script:my-fork:2.0 (by /u/alice)", "script:my-fork:2.0 (by /u/alice)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			t.Setenv("REDDIT_API_BASE_URL", srv.URL)
+			t.Setenv("REDDIT_AUTH_BASE_URL", srv.URL)
+			t.Setenv("REDDIT_USER_AGENT", tt.userAgent)
+			cfg, err := syncer.LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+
+			client := newConfiguredRedditClient(cfg, cfg.Username, "test-refresh")
+			if _, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0); err != nil {
+				t.Fatalf("GetListing: %v", err)
+			}
+			if sent != tt.want {
+				t.Errorf("User-Agent = %q, want %q", sent, tt.want)
+			}
+		})
+	}
+	if !strings.Contains(tests[0].want, "/u/alice") {
+		t.Errorf("generated User-Agent %q does not name the account", tests[0].want)
+	}
+}
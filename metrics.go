@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// Counters served on /metrics, in addition to those of the reddit and
+// dynalist packages and syncer.FetchErrors
+var (
+	postsProcessed atomic.Int64
+	postsFailed    atomic.Int64
+	// redditErrors counts failed authentication checks
+	redditErrors atomic.Int64
+)
+
+// metricsHandler serves the counters in the Prometheus text format. The
+// counters stay plain atomics, read on every scrape, since the packages
+// updating them don't depend on Prometheus.
+func metricsHandler(cache *syncer.Cache) http.Handler {
+	registry := prometheus.NewRegistry()
+	counter := func(name, help string, value func() int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help},
+			func() float64 { return float64(value()) })
+	}
+	registry.MustRegister(
+		counter("r2d_posts_processed_total", "Posts delivered to a sink.", postsProcessed.Load),
+		counter("r2d_posts_failed_total", "Posts a sink failed to accept.", postsFailed.Load),
+		counter("r2d_reddit_requests_total", "Requests sent to the Reddit API.", reddit.Requests.Load),
+		counter("r2d_reddit_errors_total", "Failed Reddit fetches and authentication checks.",
+			func() int64 { return syncer.FetchErrors.Load() + redditErrors.Load() }),
+		counter("r2d_dynalist_requests_total", "Requests sent to the Dynalist API, including retries.", dynalist.Requests.Load),
+		counter("r2d_dynalist_errors_total", "Dynalist API calls that failed after all retries.", dynalist.Errors.Load),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "r2d_cache_size", Help: "Posts in the cache."},
+			func() float64 { return float64(cache.Len()) }),
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
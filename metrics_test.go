@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// scrape returns the value of every sample served by handler
+func scrape(t *testing.T, handler http.Handler) map[string]int64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	values := make(map[string]int64)
+	for _, m := range regexp.MustCompile(`(?m)^(r2d_\w+) (\d+)$`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		values[m[1]], _ = strconv.ParseInt(m[2], 10, 64)
+	}
+	return values
+}
+
+func TestMetricsCountErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"test-access","token_type":"bearer","expires_in":3600}`)
+		case "/file/list":
+			io.WriteString(w, `{"_code":"InvalidToken","_msg":"Invalid token"}`)
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("REDDIT_CLIENT_ID", "test-client")
+	t.Setenv("REDDIT_USERNAME", "alice")
+	t.Setenv("DYNALIST_API_KEY", "test-token")
+	t.Setenv("SINK", syncer.SinkMarkdown)
+	t.Setenv("MARKDOWN_FILE", filepath.Join(t.TempDir(), "saved.md"))
+	cfg, err := syncer.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	sink, err := syncer.NewSink(cfg)
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	redditClient, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	redditClient.BaseURL = srv.URL
+	redditClient.SetAuthBaseURL(srv.URL)
+	dynalistClient := dynalist.NewClient("test-token")
+	dynalistClient.BaseURL = srv.URL
+
+	cache := syncer.NewCache()
+	cache.MarkDelivered("t3_p1", "markdown", time.Now())
+	handler := metricsHandler(cache)
+	before := scrape(t, handler)
+
+	summary := syncer.RunCycle(context.Background(), redditClient, cfg, sink, cache, filepath.Join(t.TempDir(), "cache.json"))
+	if summary.Err == nil {
+		t.Fatal("RunCycle succeeded against a failing listing")
+	}
+	if err := dynalistClient.VerifyAPIKey(context.Background()); err == nil {
+		t.Fatal("VerifyAPIKey succeeded with a rejected key")
+	}
+
+	after := scrape(t, handler)
+	for name, want := range map[string]int64{
+		"r2d_reddit_errors_total":     1,
+		"r2d_dynalist_errors_total":   1,
+		"r2d_dynalist_requests_total": 1,
+	} {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s went up by %d, want %d", name, got, want)
+		}
+	}
+	if after["r2d_reddit_requests_total"] <= before["r2d_reddit_requests_total"] {
+		t.Error("r2d_reddit_requests_total did not go up")
+	}
+	if got := after["r2d_cache_size"]; got != 1 {
+		t.Errorf("r2d_cache_size = %d, want 1", got)
+	}
+	if len(after) != 7 {
+		t.Errorf("got %d metrics, want 7: %s", len(after), fmt.Sprint(after))
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler(syncer.NewCache()).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# HELP r2d_posts_processed_total Posts delivered to a sink.\n# TYPE r2d_posts_processed_total counter\n",
+		"# TYPE r2d_cache_size gauge\nr2d_cache_size 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics miss %q:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// webhookTimeout bounds a notification so a slow webhook can't hold up
+// the next cycle
+const webhookTimeout = 10 * time.Second
+
+// WebhookNotifier posts a message about each cycle that added posts to a
+// Slack or Discord incoming webhook
+type WebhookNotifier struct {
+	HTTPClient *http.Client
+	URL        string
+}
+
+// NewWebhookNotifier creates a notifier for url sending through transport
+func NewWebhookNotifier(url string, transport http.RoundTripper) *WebhookNotifier {
+	return &WebhookNotifier{
+		HTTPClient: &http.Client{Transport: transport, Timeout: webhookTimeout},
+		URL:        url,
+	}
+}
+
+// Notify posts a message about s if it added posts
+func (n *WebhookNotifier) Notify(ctx context.Context, s syncer.Summary) error {
+	if s.Added == 0 {
+		return nil
+	}
+	text := fmt.Sprintf("Imported %d new saved posts", s.Added)
+	if s.Added == 1 {
+		text = "Imported 1 new saved post"
+	}
+	if s.Job != "" {
+		text += fmt.Sprintf(" (job %s)", s.Job)
+	}
+	// Slack reads "text" and Discord "content", each ignores the other
+	data, err := json.Marshal(map[string]string{"text": text, "content": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook error: %s, Body: %s", resp.Status, string(body))
+	}
+	return nil
+}
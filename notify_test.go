@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+func TestWebhookNotifierBody(t *testing.T) {
+	var bodies []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode webhook body: %v", err)
+		}
+		bodies = append(bodies, body)
+	}))
+	t.Cleanup(srv.Close)
+	notifier := NewWebhookNotifier(srv.URL, http.DefaultTransport)
+
+	for _, s := range []syncer.Summary{{Added: 3}, {Added: 0}, {Added: 1, Job: "work"}} {
+		if err := notifier.Notify(context.Background(), s); err != nil {
+			t.Fatalf("Notify(%+v): %v", s, err)
+		}
+	}
+	want := []string{"Imported 3 new saved posts", "Imported 1 new saved post (job work)"}
+	if len(bodies) != len(want) {
+		t.Fatalf("webhook called %d times, want %d: %v", len(bodies), len(want), bodies)
+	}
+	for i, text := range want {
+		if bodies[i]["text"] != text || bodies[i]["content"] != text {
+			t.Errorf("body %d = %v, want text and content %q", i, bodies[i], text)
+		}
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := NewWebhookNotifier(srv.URL, http.DefaultTransport).Notify(context.Background(), syncer.Summary{Added: 2})
+	if err == nil {
+		t.Error("Notify succeeded on a 403")
+	}
+}
@@ -0,0 +1,68 @@
+package dynalist_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/internal/cassette"
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+)
+
+// newCassetteClient returns a client replaying the recorded interactions
+// of a cassette in testdata
+func newCassetteClient(t *testing.T, name string) *dynalist.Client {
+	t.Helper()
+	client := dynalist.NewClient(cassette.Redacted)
+	client.BaseURL = cassette.Replay(t, "testdata/"+name).URL
+	return client
+}
+
+func TestFileListCassette(t *testing.T) {
+	client := newCassetteClient(t, "file_list.json")
+	file, err := client.FindDocument(context.Background(), "Reddit", false)
+	if err != nil {
+		t.Fatalf("FindDocument: %v", err)
+	}
+	// The folder "Reading" and the document "Inbox" are passed over
+	if file.ID != "J7Xm4mrpOKIK6_n7SOwrRuKp" || file.Type != "document" {
+		t.Errorf("file = %+v", file)
+	}
+}
+
+func TestDocEditCassette(t *testing.T) {
+	ctx := context.Background()
+	client := newCassetteClient(t, "doc_edit.json")
+	doc, err := client.ReadDocument(ctx, "J7Xm4mrpOKIK6_n7SOwrRuKp")
+	if err != nil {
+		t.Fatalf("ReadDocument: %v", err)
+	}
+	if got := len(doc.Ordered()); got != 3 {
+		t.Errorf("document has %d nodes in order, want 3", got)
+	}
+	if doc.FindChild("root", "2024-02-06") != "" {
+		t.Fatal("today's heading exists already")
+	}
+
+	heading, err := client.InsertItem(ctx, doc.FileID, "root", dynalist.InsertPrepend, "2024-02-06", "")
+	if err != nil {
+		t.Fatalf("InsertItem: %v", err)
+	}
+	ids, err := client.EditDocument(ctx, doc.FileID, []dynalist.Change{
+		{Action: "insert", ParentID: heading, Index: 0, Content: "[r/golang] Go 1.22 is released"},
+		{Action: "insert", ParentID: heading, Index: 0, Content: "[r/programming] Some crosspost"},
+	})
+	if err != nil {
+		t.Fatalf("EditDocument: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "Fd6JpQ1sRw8Ym3Ct5Gv0NbXe" {
+		t.Errorf("new node IDs = %v", ids)
+	}
+
+	node, err := client.AddToInbox(ctx, "[r/golang] Go 1.22 is released", "https://go.dev/blog/go1.22", "")
+	if err != nil {
+		t.Fatalf("AddToInbox: %v", err)
+	}
+	if node != "Bt3NwE8qYc1Km6Ra9Ls2VdPx" {
+		t.Errorf("inbox node = %q", node)
+	}
+}
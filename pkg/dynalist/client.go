@@ -0,0 +1,502 @@
+// Package dynalist is a client for the Dynalist API: listing files, reading
+// and editing documents and adding items to the inbox.
+package dynalist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/internal/timeutil"
+)
+
+const (
+	// DefaultBaseURL is the root of the Dynalist API
+	DefaultBaseURL = "https://dynalist.io/api/v1"
+	// DefaultTimeout limits single requests of a client from NewClient
+	DefaultTimeout = 30 * time.Second
+
+	inboxAddPath = "/inbox/add"
+	fileListPath = "/file/list"
+	docReadPath  = "/doc/read"
+	docEditPath  = "/doc/edit"
+	fileEditPath = "/file/edit"
+)
+
+// Retry delays, variables so tests can shorten them
+var (
+	// retryBackoff is the first delay before retrying a failed
+	// request; it doubles per attempt
+	retryBackoff = time.Second
+	// rateLimitBackoff replaces shorter retry delays once Dynalist
+	// answered TooManyRequests, its limits being counted per minute
+	rateLimitBackoff = 5 * time.Second
+)
+
+// Counters of all clients since startup
+var (
+	// Requests counts the API requests sent, including retries
+	Requests atomic.Int64
+	// Errors counts the calls that failed after all retries
+	Errors atomic.Int64
+)
+
+// writePaths are the endpoints paced by MinWriteInterval. They are not
+// idempotent, so they are only retried when Dynalist surely did not apply
+// the request, see retryable.
+var writePaths = map[string]bool{
+	inboxAddPath: true,
+	docEditPath:  true,
+	fileEditPath: true,
+}
+
+// Where new items go among their siblings
+const (
+	InsertPrepend = "prepend"
+	InsertAppend  = "append"
+)
+
+// InsertIndex returns the Dynalist index for an insert position. Indexes
+// are relative to the parent node, and -1 means after the last child.
+func InsertIndex(position string) int {
+	if position == InsertAppend {
+		return -1
+	}
+	return 0
+}
+
+// Request represents the request body for the Dynalist API
+type Request struct {
+	Token    string `json:"token"`
+	Index    *int   `json:"index,omitempty"` // nil uses the inbox setting
+	Content  string `json:"content"`
+	Note     string `json:"note,omitempty"`
+	Checked  bool   `json:"checked,omitempty"`
+	Checkbox bool   `json:"checkbox,omitempty"`
+}
+
+// Response represents the response from the Dynalist API
+type Response struct {
+	Code    string `json:"_code"`
+	Message string `json:"_msg,omitempty"`
+	FileID  string `json:"file_id,omitempty"`
+	NodeID  string `json:"node_id,omitempty"`
+	Index   int    `json:"index,omitempty"`
+}
+
+// File represents a document or folder returned by file/list
+type File struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Type     string   `json:"type"`
+	Children []string `json:"children,omitempty"`
+}
+
+// Node represents a single item inside a Dynalist document
+type Node struct {
+	ID       string   `json:"id"`
+	Content  string   `json:"content"`
+	Note     string   `json:"note"`
+	Children []string `json:"children,omitempty"`
+}
+
+// Document represents the response of doc/read
+type Document struct {
+	FileID string `json:"file_id"`
+	Title  string `json:"title"`
+	Nodes  []Node `json:"nodes"`
+}
+
+// Change is a single change sent to doc/edit
+type Change struct {
+	Action   string `json:"action"`
+	NodeID   string `json:"node_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	// Index is the position among ParentID's children, not in the document
+	Index    int    `json:"index"`
+	Content  string `json:"content,omitempty"`
+	Note     string `json:"note,omitempty"`
+	Checked  bool   `json:"checked,omitempty"`
+	Checkbox bool   `json:"checkbox,omitempty"`
+}
+
+// Client handles interactions with the Dynalist API
+type Client struct {
+	HTTPClient *http.Client
+	Token      string
+	// BaseURL is the API root, overridable to go through a proxy
+	BaseURL string
+	// Header is added to every request, e.g. for a proxy's authentication
+	Header http.Header
+	// BasicAuthUser and BasicAuthPassword, when set, are sent as HTTP basic
+	// authentication on every request
+	BasicAuthUser     string
+	BasicAuthPassword string
+	// Retries is how often a request failing with a network error, a 5xx
+	// response or TooManyRequests is retried. 4xx responses and other API
+	// error codes are not retried, nor are writes whose response was lost.
+	Retries int
+	// MinWriteInterval is the least time between the starts of two write
+	// requests, keeping bursts of items under Dynalist's rate limit
+	MinWriteInterval time.Duration
+
+	mu        sync.Mutex
+	lastWrite time.Time
+}
+
+// NewClient creates a new Dynalist client for the given API token
+func NewClient(token string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		Token:      token,
+		BaseURL:    DefaultBaseURL,
+		Retries:    3,
+	}
+}
+
+// errTransient marks failures worth retrying: network errors and
+// 5xx responses
+var errTransient = errors.New("transient Dynalist error")
+
+// Transient failures after which Dynalist did not apply the request, so
+// even writes can be sent again. Other 5xx responses, e.g. a 502 or 504
+// from a proxy, don't rule out that the request was applied.
+var (
+	errNotSent     = fmt.Errorf("%w: request not sent", errTransient)
+	errUnavailable = fmt.Errorf("%w: service unavailable", errTransient)
+)
+
+// Dynalist API _code values callers act on
+const (
+	codeInvalidToken    = "InvalidToken"
+	codeTooManyRequests = "TooManyRequests"
+)
+
+// Error is an API response whose _code is not "Ok"
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("dynalist API error: %s (%s)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("dynalist API error: code %s", e.Code)
+}
+
+// isCode reports whether err is an *Error with the given code
+func isCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsInvalidToken reports whether Dynalist rejected the API key
+func IsInvalidToken(err error) bool {
+	return isCode(err, codeInvalidToken)
+}
+
+// IsTooManyRequests reports whether Dynalist's rate limit was hit
+func IsTooManyRequests(err error) bool {
+	return isCode(err, codeTooManyRequests)
+}
+
+// call posts reqBody to the API path and decodes the response into out,
+// turning a non-"Ok" _code into an error. Transient failures and
+// TooManyRequests are retried up to Retries times with jittered exponential
+// backoff, starting from rateLimitBackoff for the latter; writes only as far
+// as retryable allows.
+func (d *Client) call(ctx context.Context, path string, reqBody interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	delay := retryBackoff
+	for attempt := 0; ; attempt++ {
+		if writePaths[path] {
+			if err := d.waitToWrite(ctx); err != nil {
+				Errors.Add(1)
+				return err
+			}
+		}
+		err := d.callOnce(ctx, path, jsonData, out)
+		limited := IsTooManyRequests(err)
+		if err != nil && (!retryable(path, err) || attempt >= d.Retries) {
+			Errors.Add(1)
+			return err
+		}
+		if err == nil {
+			return nil
+		}
+		if limited && delay < rateLimitBackoff {
+			delay = rateLimitBackoff
+		}
+		// Up to half the delay is random so parallel clients spread out
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		slog.Warn("Dynalist request failed, retrying", "path", path, "error", err, "wait", wait.Round(time.Millisecond))
+		if !timeutil.Sleep(ctx, wait) {
+			Errors.Add(1)
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether a request to path failing with err may be sent
+// again. A write whose connection broke after it was sent, e.g. a timeout
+// waiting for the response, or that got a 5xx other than a 503 with
+// Retry-After may have been applied, and sending it again would duplicate
+// the item.
+func retryable(path string, err error) bool {
+	if IsTooManyRequests(err) {
+		return true
+	}
+	if writePaths[path] {
+		return errors.Is(err, errNotSent) || errors.Is(err, errUnavailable)
+	}
+	return errors.Is(err, errTransient)
+}
+
+// waitToWrite blocks until MinWriteInterval has passed since the previous
+// write request started
+func (d *Client) waitToWrite(ctx context.Context) error {
+	if d.MinWriteInterval <= 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if wait := time.Until(d.lastWrite.Add(d.MinWriteInterval)); wait > 0 {
+		if !timeutil.Sleep(ctx, wait) {
+			return ctx.Err()
+		}
+	}
+	d.lastWrite = time.Now()
+	return nil
+}
+
+func (d *Client) callOnce(ctx context.Context, path string, jsonData []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", d.BaseURL+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	Requests.Add(1)
+	for name, values := range d.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if d.BasicAuthUser != "" {
+		req.SetBasicAuth(d.BasicAuthUser, d.BasicAuthPassword)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			// No connection, Dynalist never saw the request
+			return fmt.Errorf("failed to send request: %w: %w", errNotSent, err)
+		}
+		return fmt.Errorf("failed to send request: %w: %w", errTransient, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w: %w", errTransient, err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &Error{Code: codeTooManyRequests, Message: resp.Status}
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != "" {
+		// Turned away before being handled
+		return fmt.Errorf("%w: %s", errUnavailable, resp.Status)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%w: %s", errTransient, resp.Status)
+	}
+
+	var status Response
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if status.Code != "Ok" {
+		return &Error{Code: status.Code, Message: status.Message}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// ListFiles returns all documents and folders visible to the token
+func (d *Client) ListFiles(ctx context.Context) ([]File, error) {
+	var resp struct {
+		Files []File `json:"files"`
+	}
+	if err := d.call(ctx, fileListPath, map[string]string{"token": d.Token}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Files, nil
+}
+
+// VerifyAPIKey checks that the API key is accepted by listing the files
+// once. A rejected key is reported as an *Error, see IsInvalidToken.
+func (d *Client) VerifyAPIKey(ctx context.Context) error {
+	if _, err := d.ListFiles(ctx); err != nil {
+		return fmt.Errorf("failed to verify the Dynalist API key: %w", err)
+	}
+	return nil
+}
+
+// DocumentNotFoundError is returned by FindDocument when no document has
+// the requested title
+type DocumentNotFoundError struct {
+	Title     string
+	Available []string
+}
+
+func (e *DocumentNotFoundError) Error() string {
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("Dynalist document %q not found, the account has no documents", e.Title)
+	}
+	return fmt.Sprintf("Dynalist document %q not found, available documents: %s",
+		e.Title, strings.Join(e.Available, ", "))
+}
+
+// FindDocument returns the document with the given title, optionally
+// ignoring case. When there is none the error is a *DocumentNotFoundError
+// listing the titles that do exist.
+func (d *Client) FindDocument(ctx context.Context, title string, ignoreCase bool) (*File, error) {
+	files, err := d.ListFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Dynalist documents: %w", err)
+	}
+	notFound := &DocumentNotFoundError{Title: title}
+	for i := range files {
+		if files[i].Type != "document" {
+			continue
+		}
+		if files[i].Title == title || (ignoreCase && strings.EqualFold(files[i].Title, title)) {
+			return &files[i], nil
+		}
+		notFound.Available = append(notFound.Available, fmt.Sprintf("%q", files[i].Title))
+	}
+	return nil, notFound
+}
+
+// CreateDocument creates an empty document titled title at the end of the
+// folder parentFolderID, or of the root folder when that is "", and returns
+// its file ID
+func (d *Client) CreateDocument(ctx context.Context, title, parentFolderID string) (string, error) {
+	if parentFolderID == "" {
+		var list struct {
+			RootFileID string `json:"root_file_id"`
+		}
+		if err := d.call(ctx, fileListPath, map[string]string{"token": d.Token}, &list); err != nil {
+			return "", fmt.Errorf("failed to find the root folder: %w", err)
+		}
+		parentFolderID = list.RootFileID
+	}
+	type fileChange struct {
+		Action   string `json:"action"`
+		Type     string `json:"type"`
+		ParentID string `json:"parent_id"`
+		Index    int    `json:"index"`
+		Title    string `json:"title"`
+	}
+	reqBody := struct {
+		Token   string       `json:"token"`
+		Changes []fileChange `json:"changes"`
+	}{
+		Token:   d.Token,
+		Changes: []fileChange{{Action: "create", Type: "document", ParentID: parentFolderID, Index: -1, Title: title}},
+	}
+	var resp struct {
+		Created []string `json:"created"`
+	}
+	if err := d.call(ctx, fileEditPath, reqBody, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Created) == 0 {
+		return "", fmt.Errorf("dynalist API error: no file ID returned for the new document")
+	}
+	return resp.Created[0], nil
+}
+
+// ReadDocument returns the full node tree of a document
+func (d *Client) ReadDocument(ctx context.Context, fileID string) (*Document, error) {
+	reqBody := map[string]string{"token": d.Token, "file_id": fileID}
+	var doc Document
+	if err := d.call(ctx, docReadPath, reqBody, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// EditDocument applies changes to a document and returns the IDs of the
+// nodes created by insert changes, in order
+func (d *Client) EditDocument(ctx context.Context, fileID string, changes []Change) ([]string, error) {
+	reqBody := struct {
+		Token   string   `json:"token"`
+		FileID  string   `json:"file_id"`
+		Changes []Change `json:"changes"`
+	}{d.Token, fileID, changes}
+	var resp struct {
+		NewNodeIDs []string `json:"new_node_ids"`
+	}
+	if err := d.call(ctx, docEditPath, reqBody, &resp); err != nil {
+		return nil, err
+	}
+	return resp.NewNodeIDs, nil
+}
+
+// InsertItem adds an item under parentID, placed before or after the
+// parent's existing children according to position
+func (d *Client) InsertItem(ctx context.Context, fileID, parentID, position, content, note string) (string, error) {
+	ids, err := d.EditDocument(ctx, fileID, []Change{{
+		Action:   "insert",
+		ParentID: parentID,
+		Index:    InsertIndex(position),
+		Content:  content,
+		Note:     note,
+	}})
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("dynalist API returned no node id")
+	}
+	return ids[0], nil
+}
+
+// AddToInbox sends an item to the Dynalist inbox and returns the new node's
+// ID. position is InsertPrepend, InsertAppend or "" to use the inbox setting.
+func (d *Client) AddToInbox(ctx context.Context, content, note, position string) (string, error) {
+	reqBody := Request{
+		Token:   d.Token,
+		Content: content,
+		Note:    note,
+	}
+	if position != "" {
+		index := InsertIndex(position)
+		reqBody.Index = &index
+	}
+	var resp Response
+	if err := d.call(ctx, inboxAddPath, reqBody, &resp); err != nil {
+		return "", err
+	}
+	return resp.NodeID, nil
+}
@@ -0,0 +1,216 @@
+package dynalist
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryClient returns a client with short retry delays whose requests go
+// to handler, and a counter of the requests handler got
+func newRetryClient(t *testing.T, handler func(n int64, w http.ResponseWriter, r *http.Request)) (*Client, *atomic.Int64) {
+	t.Helper()
+	retry, limit := retryBackoff, rateLimitBackoff
+	retryBackoff, rateLimitBackoff = time.Millisecond, time.Millisecond
+	t.Cleanup(func() { retryBackoff, rateLimitBackoff = retry, limit })
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		handler(requests.Add(1), w, r)
+	}))
+	t.Cleanup(srv.Close)
+	client := NewClient("test-token")
+	client.BaseURL = srv.URL
+	return client, &requests
+}
+
+// dropConnection closes the connection without answering, as if the
+// response was lost after Dynalist got the request
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatalf("Hijack: %v", err)
+	}
+	conn.Close()
+}
+
+func TestWriteRetriedWhenUnavailable(t *testing.T) {
+	client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		if n <= 2 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"_code":"Ok","new_node_ids":["n1"]}`)
+	})
+
+	id, err := client.InsertItem(context.Background(), "d1", "root", InsertPrepend, "item", "")
+	if err != nil || id != "n1" {
+		t.Fatalf("InsertItem = %q, %v, want n1 after two failures", id, err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestServerErrorRetriedForReadsOnly(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusServiceUnavailable} {
+		client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+			// A 503 without Retry-After may come from a proxy, too
+			http.Error(w, "gateway", status)
+		})
+
+		if _, err := client.AddToInbox(context.Background(), "item", "", ""); err == nil {
+			t.Fatalf("%d: AddToInbox succeeded", status)
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("%d: the write was sent %d times, want once since it may have been applied", status, got)
+		}
+
+		requests.Store(0)
+		if _, err := client.ListFiles(context.Background()); err == nil {
+			t.Fatalf("%d: ListFiles succeeded", status)
+		}
+		if got := requests.Load(); got != int64(client.Retries)+1 {
+			t.Errorf("%d: the read was sent %d times, want %d", status, got, client.Retries+1)
+		}
+	}
+}
+
+func TestWriteRetriedAfterTooManyRequests(t *testing.T) {
+	client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"_code":"Ok","node_id":"n1"}`)
+	})
+
+	if _, err := client.AddToInbox(context.Background(), "item", "", ""); err != nil {
+		t.Fatalf("AddToInbox: %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want the 429 retried once", got)
+	}
+}
+
+func TestLostResponseRetriedForReadsOnly(t *testing.T) {
+	client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		dropConnection(t, w)
+	})
+
+	if _, err := client.AddToInbox(context.Background(), "item", "", ""); err == nil {
+		t.Fatal("AddToInbox succeeded without a response")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("the write was sent %d times, want once since it may have been applied", got)
+	}
+
+	requests.Store(0)
+	if _, err := client.ListFiles(context.Background()); err == nil {
+		t.Fatal("ListFiles succeeded without a response")
+	}
+	if got := requests.Load(); got != int64(client.Retries)+1 {
+		t.Errorf("the read was sent %d times, want %d", got, client.Retries+1)
+	}
+}
+
+func TestWriteRetriedWhenNotSent(t *testing.T) {
+	client, _ := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {})
+	// A port nothing listens on, so every dial fails
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = "http://" + l.Addr().String()
+	l.Close()
+
+	before := Requests.Load()
+	if _, err := client.AddToInbox(context.Background(), "item", "", ""); err == nil {
+		t.Fatal("AddToInbox succeeded without a server")
+	}
+	if got := Requests.Load() - before; got != int64(client.Retries)+1 {
+		t.Errorf("the write was attempted %d times, want %d", got, client.Retries+1)
+	}
+}
+
+func TestWriteRetriedAfterTooManyRequestsCode(t *testing.T) {
+	client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		if n <= 2 {
+			io.WriteString(w, `{"_code":"TooManyRequests","_msg":"Too many requests"}`)
+			return
+		}
+		io.WriteString(w, `{"_code":"Ok","new_node_ids":["n1"]}`)
+	})
+
+	if _, err := client.InsertItem(context.Background(), "d1", "root", InsertAppend, "item", ""); err != nil {
+		t.Fatalf("InsertItem: %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want the rate limited write retried twice", got)
+	}
+}
+
+func TestMinWriteIntervalPacesWrites(t *testing.T) {
+	var mu sync.Mutex
+	var writes, reads []time.Time
+	client, _ := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.URL.Path == fileListPath {
+			reads = append(reads, time.Now())
+		} else {
+			writes = append(writes, time.Now())
+		}
+		mu.Unlock()
+		io.WriteString(w, `{"_code":"Ok","node_id":"n","files":[]}`)
+	})
+	client.MinWriteInterval = 50 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.AddToInbox(context.Background(), "item", "", ""); err != nil {
+			t.Fatalf("AddToInbox: %v", err)
+		}
+		if _, err := client.ListFiles(context.Background()); err != nil {
+			t.Fatalf("ListFiles: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// Measured on arrival, so allow for some delivery jitter
+	for i := 1; i < len(writes); i++ {
+		if gap := writes[i].Sub(writes[i-1]); gap < client.MinWriteInterval-10*time.Millisecond {
+			t.Errorf("write %d came %s after the previous one, want at least %s", i, gap, client.MinWriteInterval)
+		}
+	}
+	// Reads are not paced
+	if len(reads) != 3 || reads[0].Sub(writes[0]) >= client.MinWriteInterval {
+		t.Errorf("reads at %v after writes at %v, want them unpaced", reads, writes)
+	}
+
+}
+
+func TestMinWriteIntervalCancelledWait(t *testing.T) {
+	client, requests := newRetryClient(t, func(n int64, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"_code":"Ok","node_id":"n"}`)
+	})
+	client.MinWriteInterval = time.Hour
+	if _, err := client.AddToInbox(context.Background(), "item", "", ""); err != nil {
+		t.Fatalf("AddToInbox: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.AddToInbox(ctx, "item", "", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AddToInbox error = %v, want the wait for the next write slot cut short", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want the second write never sent", got)
+	}
+}
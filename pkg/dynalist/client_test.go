@@ -0,0 +1,283 @@
+package dynalist_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+)
+
+// newTestClient returns a client pointed at a server answering every
+// request with handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *dynalist.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := dynalist.NewClient("test-token")
+	client.BaseURL = srv.URL
+	return client
+}
+
+// decodeBody decodes a request's JSON body into a generic map
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("failed to read request body: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("failed to decode request body %s: %v", data, err)
+	}
+	return body
+}
+
+func TestListFiles(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file/list" {
+			t.Errorf("path = %q, want /file/list", r.URL.Path)
+		}
+		if got := decodeBody(t, r)["token"]; got != "test-token" {
+			t.Errorf("token = %v, want test-token", got)
+		}
+		io.WriteString(w, `{"_code":"Ok","root_file_id":"r","files":[
+			{"id":"r","title":"Root","type":"folder","children":["d1"]},
+			{"id":"d1","title":"Reddit","type":"document"}]}`)
+	})
+
+	files, err := client.ListFiles(context.Background())
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files) != 2 || files[1].ID != "d1" || files[1].Title != "Reddit" || files[1].Type != "document" {
+		t.Errorf("files = %+v", files)
+	}
+}
+
+func TestFindDocument(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"_code":"Ok","files":[{"id":"d1","title":"Reddit","type":"document"}]}`)
+	})
+
+	if _, err := client.FindDocument(context.Background(), "reddit", false); err == nil {
+		t.Error("FindDocument matched a title differing in case without ignoreCase")
+	}
+	file, err := client.FindDocument(context.Background(), "reddit", true)
+	if err != nil {
+		t.Fatalf("FindDocument: %v", err)
+	}
+	if file.ID != "d1" {
+		t.Errorf("file ID = %q, want d1", file.ID)
+	}
+}
+
+func TestVerifyAPIKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		wantErr      bool
+		invalidToken bool
+	}{
+		{"valid", `{"_code":"Ok","root_file_id":"r","files":[]}`, false, false},
+		{"invalid token", `{"_code":"InvalidToken","_msg":"Invalid token"}`, true, true},
+		{"other error", `{"_code":"Unauthorized","_msg":"Not allowed"}`, true, false},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/file/list" {
+				t.Errorf("path = %q, want /file/list", r.URL.Path)
+			}
+			io.WriteString(w, tt.response)
+		})
+
+		err := client.VerifyAPIKey(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: VerifyAPIKey error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if dynalist.IsInvalidToken(err) != tt.invalidToken {
+			t.Errorf("%s: IsInvalidToken(%v) = %v, want %v", tt.name, err, !tt.invalidToken, tt.invalidToken)
+		}
+	}
+}
+
+func TestAPIErrorCodes(t *testing.T) {
+	tests := []struct {
+		code            string
+		invalidToken    bool
+		tooManyRequests bool
+	}{
+		{"InvalidToken", true, false},
+		{"TooManyRequests", false, true},
+		{"NotFound", false, false},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"_code":"`+tt.code+`","_msg":"Something went wrong"}`)
+		})
+		client.Retries = 0
+
+		_, err := client.ReadDocument(context.Background(), "d1")
+		var apiErr *dynalist.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != tt.code || apiErr.Message != "Something went wrong" {
+			t.Errorf("%s: error = %#v, want a *dynalist.Error with the code and message", tt.code, err)
+		}
+		if dynalist.IsInvalidToken(err) != tt.invalidToken {
+			t.Errorf("%s: IsInvalidToken = %v, want %v", tt.code, !tt.invalidToken, tt.invalidToken)
+		}
+		if dynalist.IsTooManyRequests(err) != tt.tooManyRequests {
+			t.Errorf("%s: IsTooManyRequests = %v, want %v", tt.code, !tt.tooManyRequests, tt.tooManyRequests)
+		}
+	}
+	if dynalist.IsInvalidToken(nil) || dynalist.IsTooManyRequests(errors.New("other")) {
+		t.Error("the helpers matched an error that is not a *dynalist.Error")
+	}
+}
+
+func TestInsertItemUnderParent(t *testing.T) {
+	tests := []struct {
+		position string
+		want     float64
+	}{
+		{dynalist.InsertPrepend, 0},
+		{dynalist.InsertAppend, -1},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		var change map[string]interface{}
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			changes := decodeBody(t, r)["changes"].([]interface{})
+			change = changes[0].(map[string]interface{})
+			io.WriteString(w, `{"_code":"Ok","new_node_ids":["new"]}`)
+		})
+		if _, err := client.InsertItem(context.Background(), "f", "heading", tt.position, "item", ""); err != nil {
+			t.Fatalf("InsertItem: %v", err)
+		}
+		// The index counts the heading's children, not the document's nodes
+		if change["parent_id"] != "heading" || change["index"] != tt.want {
+			t.Errorf("position %q: change = %v, want index %v under heading", tt.position, change, tt.want)
+		}
+	}
+}
+
+func TestAddToInboxIndex(t *testing.T) {
+	tests := []struct {
+		position string
+		want     interface{}
+	}{
+		{dynalist.InsertPrepend, float64(0)},
+		{dynalist.InsertAppend, float64(-1)},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		var body map[string]interface{}
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			body = decodeBody(t, r)
+			io.WriteString(w, `{"_code":"Ok","node_id":"n"}`)
+		})
+		if _, err := client.AddToInbox(context.Background(), "item", "", tt.position); err != nil {
+			t.Fatalf("AddToInbox: %v", err)
+		}
+		if body["index"] != tt.want {
+			t.Errorf("position %q: index = %v, want %v", tt.position, body["index"], tt.want)
+		}
+	}
+}
+
+func TestCancelMidRequest(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	// Runs before the server is closed, which waits for the handler
+	t.Cleanup(func() { close(release) })
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := client.InsertItem(ctx, "d1", "root", dynalist.InsertPrepend, "content", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("InsertItem error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCreateDocument(t *testing.T) {
+	var change map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/list":
+			io.WriteString(w, `{"_code":"Ok","root_file_id":"root-folder","files":[]}`)
+		case "/file/edit":
+			change = decodeBody(t, r)["changes"].([]interface{})[0].(map[string]interface{})
+			io.WriteString(w, `{"_code":"Ok","results":[true],"created":["new-doc"]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+
+	id, err := client.CreateDocument(context.Background(), "Reddit", "")
+	if err != nil {
+		t.Fatalf("CreateDocument: %v", err)
+	}
+	if id != "new-doc" {
+		t.Errorf("id = %q, want new-doc", id)
+	}
+	want := map[string]interface{}{"action": "create", "type": "document", "parent_id": "root-folder", "title": "Reddit"}
+	for key, value := range want {
+		if change[key] != value {
+			t.Errorf("change %s = %v, want %v", key, change[key], value)
+		}
+	}
+}
+
+func TestAddToInboxPayload(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body = decodeBody(t, r)
+		io.WriteString(w, `{"_code":"Ok","file_id":"inbox","node_id":"n1","index":0}`)
+	})
+
+	id, err := client.AddToInbox(context.Background(), "A post", "https://reddit.com/r/golang/comments/p1/", "")
+	if err != nil {
+		t.Fatalf("AddToInbox: %v", err)
+	}
+	if path != "/inbox/add" {
+		t.Errorf("path = %q, want /inbox/add", path)
+	}
+	if id != "n1" {
+		t.Errorf("node ID = %q, want n1", id)
+	}
+	want := map[string]interface{}{"token": "test-token", "content": "A post", "note": "https://reddit.com/r/golang/comments/p1/"}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+	if _, ok := body["file_id"]; ok {
+		t.Errorf("body = %v, want no document named", body)
+	}
+}
+
+func TestInsertItemNote(t *testing.T) {
+	var change map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		change = decodeBody(t, r)["changes"].([]interface{})[0].(map[string]interface{})
+		io.WriteString(w, `{"_code":"Ok","new_node_ids":["n1"]}`)
+	})
+
+	if _, err := client.InsertItem(context.Background(), "f", "root", dynalist.InsertAppend, "A post", "https://reddit.com/r/golang/comments/p1/"); err != nil {
+		t.Fatalf("InsertItem: %v", err)
+	}
+	if change["content"] != "A post" || change["note"] != "https://reddit.com/r/golang/comments/p1/" {
+		t.Errorf("change = %v, want the title as content and the link as note", change)
+	}
+}
@@ -0,0 +1,56 @@
+package dynalist
+
+// HasNode reports whether the document contains the node
+func (d *Document) HasNode(id string) bool {
+	for _, node := range d.Nodes {
+		if node.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// FindChild returns the ID of parentID's child whose content is exactly
+// content, or "" when there is none
+func (d *Document) FindChild(parentID, content string) string {
+	byID := d.byID()
+	parent, ok := byID[parentID]
+	if !ok {
+		return ""
+	}
+	for _, id := range parent.Children {
+		if child, ok := byID[id]; ok && child.Content == content {
+			return id
+		}
+	}
+	return ""
+}
+
+// Ordered returns the document's nodes depth first, the order they are
+// shown in
+func (d *Document) Ordered() []*Node {
+	byID := d.byID()
+	var ordered []*Node
+	var visit func(id string)
+	visit = func(id string) {
+		node, ok := byID[id]
+		if !ok {
+			return
+		}
+		ordered = append(ordered, node)
+		for _, child := range node.Children {
+			visit(child)
+		}
+	}
+	visit("root")
+	return ordered
+}
+
+// byID indexes the nodes by their ID
+func (d *Document) byID() map[string]*Node {
+	byID := make(map[string]*Node, len(d.Nodes))
+	for i := range d.Nodes {
+		byID[d.Nodes[i].ID] = &d.Nodes[i]
+	}
+	return byID
+}
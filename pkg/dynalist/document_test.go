@@ -0,0 +1,53 @@
+package dynalist_test
+
+import (
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+)
+
+// testDocument is a root with two headings, the first having one child
+var testDocument = dynalist.Document{
+	FileID: "f",
+	Nodes: []dynalist.Node{
+		{ID: "c", Content: "child"},
+		{ID: "root", Content: "Reddit", Children: []string{"a", "b"}},
+		{ID: "b", Content: "second"},
+		{ID: "a", Content: "first", Children: []string{"c"}},
+	},
+}
+
+func TestDocumentOrdered(t *testing.T) {
+	var got []string
+	for _, node := range testDocument.Ordered() {
+		got = append(got, node.ID)
+	}
+	want := []string{"root", "a", "c", "b"}
+	if len(got) != len(want) {
+		t.Fatalf("Ordered() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Ordered() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDocumentFindChild(t *testing.T) {
+	tests := []struct {
+		parent, content, want string
+	}{
+		{"root", "second", "b"},
+		{"a", "child", "c"},
+		{"root", "child", ""},
+		{"missing", "first", ""},
+	}
+	for _, tt := range tests {
+		if got := testDocument.FindChild(tt.parent, tt.content); got != tt.want {
+			t.Errorf("FindChild(%q, %q) = %q, want %q", tt.parent, tt.content, got, tt.want)
+		}
+	}
+	if !testDocument.HasNode("c") || testDocument.HasNode("x") {
+		t.Error("HasNode does not match the document's nodes")
+	}
+}
@@ -0,0 +1,96 @@
+package reddit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// mePath returns the account the access token belongs to
+const mePath = "/api/v1/me"
+
+// VerifyAuthentication checks that the token still works, belongs to
+// username and carries every scope the sync needs. Reddit can hand out a
+// token with fewer scopes than requested, after which the saved listing
+// comes back empty instead of failing.
+func (r *Client) VerifyAuthentication(ctx context.Context, username string) error {
+	resp, err := r.get(ctx, r.BaseURL+mePath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := checkChallenge(resp, body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Reddit API error: %s, Body: %s", resp.Status, string(body))
+	}
+	var me struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &me); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !strings.EqualFold(me.Name, username) {
+		return fmt.Errorf("token belongs to %q, not REDDIT_USERNAME %q", me.Name, username)
+	}
+
+	if r.tokenSource == nil {
+		return nil
+	}
+	token, err := r.tokenSource.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", classifyAuthError(err))
+	}
+	granted, ok := token.Extra("scope").(string)
+	if !ok {
+		// Not every token response lists scopes; nothing to compare then
+		return nil
+	}
+	if missing := missingScopes(granted, scopes); len(missing) > 0 {
+		return fmt.Errorf("token lacks scopes %s (granted %q)", strings.Join(missing, ", "), granted)
+	}
+	return nil
+}
+
+// missingScopes returns the wanted scopes absent from a granted scope string,
+// which Reddit separates with spaces or commas
+func missingScopes(granted string, wanted []string) []string {
+	have := make(map[string]bool)
+	for _, s := range strings.FieldsFunc(granted, func(r rune) bool { return r == ' ' || r == ',' }) {
+		have[s] = true
+	}
+	var missing []string
+	for _, s := range wanted {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// RecheckAuthentication verifies the token and, if that fails, fetches a
+// fresh one and verifies again. The error describes what is still wrong.
+func (r *Client) RecheckAuthentication(ctx context.Context, username string) error {
+	err := r.VerifyAuthentication(ctx, username)
+	if err == nil || errors.Is(err, ErrChallenge) {
+		// A challenge page proves nothing about the token either way
+		return err
+	}
+	slog.Warn("Reddit authentication check failed, refreshing the access token", "error", err)
+	r.Reauthenticate()
+	if err := r.VerifyAuthentication(ctx, username); err != nil {
+		return fmt.Errorf("Reddit authentication degraded: %w", err)
+	}
+	slog.Info("Reddit authentication restored after refreshing the access token")
+	return nil
+}
@@ -0,0 +1,28 @@
+package reddit_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAuthenticationUsernameCase(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/me" {
+			t.Errorf("path = %q, want /api/v1/me", r.URL.Path)
+		}
+		io.WriteString(w, `{"name":"JohnDoe"}`)
+	})
+
+	for _, username := range []string{"JohnDoe", "johndoe", "JOHNDOE"} {
+		if err := client.VerifyAuthentication(context.Background(), username); err != nil {
+			t.Errorf("VerifyAuthentication(%q) of JohnDoe's token: %v", username, err)
+		}
+	}
+	err := client.VerifyAuthentication(context.Background(), "JaneDoe")
+	if err == nil || !strings.Contains(err.Error(), `"JohnDoe"`) {
+		t.Errorf("VerifyAuthentication(JaneDoe) of JohnDoe's token = %v, want an error naming the account", err)
+	}
+}
@@ -0,0 +1,74 @@
+package reddit_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/internal/cassette"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// newCassetteClient returns a client replaying the recorded interactions
+// of a cassette in testdata, for both API and token requests
+func newCassetteClient(t *testing.T, name string) *reddit.Client {
+	t.Helper()
+	srv := cassette.Replay(t, "testdata/"+name)
+	client, err := reddit.NewClient("test-client", cassette.Redacted, http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+	return client
+}
+
+func TestAuthCassette(t *testing.T) {
+	client := newCassetteClient(t, "auth.json")
+	if err := client.VerifyAuthentication(context.Background(), "alice"); err != nil {
+		t.Fatalf("VerifyAuthentication: %v", err)
+	}
+}
+
+func TestSavedCassette(t *testing.T) {
+	client := newCassetteClient(t, "saved.json")
+	postsCh, errs := client.StreamListing(context.Background(), "alice", reddit.ListingSaved, 2, 0, "", nil)
+	var posts []reddit.Post
+	for post := range postsCh {
+		posts = append(posts, post)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("StreamListing: %v", err)
+	}
+	if len(posts) != 3 {
+		t.Fatalf("got %d posts, want 3 over two pages", len(posts))
+	}
+
+	link := posts[0]
+	if link.FullID != "t3_1akz9q3" || link.IsComment || link.Title != "Go 1.22 is released" {
+		t.Errorf("link post = %+v", link)
+	}
+	if link.ExternalURL() != "https://go.dev/blog/go1.22" {
+		t.Errorf("ExternalURL() = %q", link.ExternalURL())
+	}
+	if link.NumComments == nil || *link.NumComments != 57 || link.Score != 412 {
+		t.Errorf("stats = %d, %v", link.Score, link.NumComments)
+	}
+
+	comment := posts[1]
+	if comment.FullID != "t1_kq9zx2a" || !comment.IsComment || comment.Author != "seasoned_dev" {
+		t.Errorf("comment = %+v", comment)
+	}
+	if want := "https://www.reddit.com/r/golang/comments/1ak3v0m/how_do_you_structure_larger_go_services/"; comment.SubmissionURL() != want {
+		t.Errorf("SubmissionURL() = %q, want %q", comment.SubmissionURL(), want)
+	}
+	if got := comment.CreatedTime(); got.Unix() != 1707150000 || got.Nanosecond() != 5e8 {
+		t.Errorf("CreatedTime() = %v", got)
+	}
+
+	crosspost := posts[2]
+	if crosspost.OriginSubreddit() != "golang" || crosspost.ExternalURL() != "" {
+		t.Errorf("crosspost = %+v", crosspost)
+	}
+}
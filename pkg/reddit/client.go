@@ -0,0 +1,470 @@
+// Package reddit is a client for the parts of the Reddit API a saved posts
+// sync needs: OAuth with a refresh token, user listings and unsaving.
+package reddit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/korjavin/reddit2dynalist/internal/timeutil"
+)
+
+const (
+	// RedirectURI is where Reddit sends the browser after authorization,
+	// as registered for the app
+	RedirectURI = "http://localhost:8080/callback"
+
+	// PageSize is the number of items requested per listing page, the most
+	// Reddit returns at once
+	PageSize = 100
+	// ListingCap is the most items Reddit lists, however far one pages
+	ListingCap = 1000
+
+	// DefaultTimeout limits single requests unless NewClient is given
+	// another timeout
+	DefaultTimeout = 30 * time.Second
+)
+
+// softLimitBackoff is the first delay before retrying a transient listing
+// response, doubled on every further attempt. Tests shorten it.
+var softLimitBackoff = 2 * time.Second
+
+// Listings of a user that can be fetched, see Client.StreamListing
+const (
+	ListingSaved   = "saved"
+	ListingUpvoted = "upvoted"
+)
+
+// Requests counts the API requests sent by all clients since startup,
+// including retries
+var Requests atomic.Int64
+
+// Client handles interactions with the Reddit API
+type Client struct {
+	HTTPClient *http.Client
+	UserAgent  string
+	// BaseURL is the API root, overridable e.g. to point at a test server
+	BaseURL string
+	// SoftLimitRetries is how often a transient listing response is retried
+	SoftLimitRetries int
+	// RateLimitRetries is how often a 429 response is retried after
+	// waiting for the rate limit window to reset
+	RateLimitRetries int
+
+	// pauseUntil is when the exhausted rate limit window resets
+	pauseUntil time.Time
+
+	oauth2Config *oauth2.Config
+	refreshToken string
+	tokenSource  oauth2.TokenSource
+	transport    http.RoundTripper
+	timeout      time.Duration
+}
+
+// ErrTransient marks responses that are worth retrying
+var ErrTransient = errors.New("transient Reddit response")
+
+// ErrChallenge marks an HTML bot-protection page served instead of
+// the API response. It is transient and says nothing about the credentials.
+var ErrChallenge = errors.New("Reddit answered with a Cloudflare challenge page instead of JSON, " +
+	"this is rate limiting or IP reputation, not an authentication failure")
+
+// ErrInvalidGrant means Reddit rejected the refresh token for good, e.g.
+// after a password change, and retrying won't help
+var ErrInvalidGrant = errors.New("Reddit rejected the refresh token (invalid_grant)")
+
+// classifyAuthError marks token refresh failures that need new credentials
+// with ErrInvalidGrant. Other token endpoint errors are left as they are
+// and retried on the next cycle.
+func classifyAuthError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+		return fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+	return err
+}
+
+// scopes are the OAuth scopes the app asks for
+var scopes = []string{"history", "identity", "read", "save"}
+
+// Default roots of the Reddit API and of its OAuth authorize and token
+// endpoints
+const (
+	DefaultAPIBaseURL  = "https://oauth.reddit.com"
+	DefaultAuthBaseURL = "https://www.reddit.com"
+)
+
+// NewOAuthConfig returns the OAuth configuration of the installed app,
+// authorizing against authBaseURL
+func NewOAuthConfig(clientID, authBaseURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: "",
+		RedirectURL:  RedirectURI,
+		Scopes:       scopes,
+		Endpoint:     oauthEndpoint(authBaseURL),
+	}
+}
+
+// oauthEndpoint returns the authorize and token URLs under base
+func oauthEndpoint(base string) oauth2.Endpoint {
+	return oauth2.Endpoint{
+		TokenURL: base + "/api/v1/access_token",
+		AuthURL:  base + "/api/v1/authorize",
+	}
+}
+
+// NewClient creates a new Reddit client using the installed app flow,
+// through transport, which carries any custom TLS settings. timeout limits
+// each request, including token refreshes.
+func NewClient(clientID, refreshToken string, transport http.RoundTripper, timeout time.Duration) (*Client, error) {
+	client := &Client{
+		UserAgent:        DefaultUserAgent("", ""),
+		SoftLimitRetries: 3,
+		RateLimitRetries: 3,
+		BaseURL:          DefaultAPIBaseURL,
+		timeout:          timeout,
+		oauth2Config:     NewOAuthConfig(clientID, DefaultAuthBaseURL),
+		refreshToken:     refreshToken,
+		transport:        transport,
+	}
+	client.Reauthenticate()
+	return client, nil
+}
+
+// DefaultUserAgent is the User-Agent sent without REDDIT_USER_AGENT, naming
+// the app version and the account as Reddit's API rules ask
+func DefaultUserAgent(version, username string) string {
+	if version == "" {
+		version = "dev"
+	}
+	if username == "" {
+		username = "unknown"
+	}
+	return "script:reddit2dynalist:" + version + " (by /u/" + username + ")"
+}
+
+// LooksLikeBrowser reports whether a User-Agent imitates a web browser,
+// which Reddit throttles or blocks for API clients
+func LooksLikeBrowser(userAgent string) bool {
+	return strings.HasPrefix(userAgent, "Mozilla/")
+}
+
+// SetAuthBaseURL makes token refreshes use the token endpoint under base,
+// e.g. a test server, instead of www.reddit.com
+func (r *Client) SetAuthBaseURL(base string) {
+	r.oauth2Config.Endpoint = oauthEndpoint(base)
+	r.Reauthenticate()
+}
+
+// Reauthenticate drops the current access token so the next request fetches
+// a fresh one with the refresh token
+func (r *Client) Reauthenticate() {
+	ctx := OAuthContext(context.Background(), r.transport, r.timeout)
+	token := &oauth2.Token{RefreshToken: r.refreshToken}
+	r.tokenSource = oauth2.ReuseTokenSource(nil, r.oauth2Config.TokenSource(ctx, token))
+	r.HTTPClient = oauth2.NewClient(ctx, r.tokenSource)
+	r.HTTPClient.Timeout = r.timeout
+}
+
+// PostFilter reports whether a fetched post should be kept
+type PostFilter func(Post) bool
+
+// GetListing returns the newest posts of a user's listing, ListingSaved or
+// ListingUpvoted, following it over as many pages as needed for max items (0
+// means the whole listing, which Reddit caps at 1000)
+func (r *Client) GetListing(ctx context.Context, username, listing string, max int) ([]Post, error) {
+	postsCh, errs := r.StreamListing(ctx, username, listing, PageSize, max, "", nil)
+	var posts []Post
+	for post := range postsCh {
+		posts = append(posts, post)
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// StreamListing pages through a listing of a user, ListingSaved or
+// ListingUpvoted, sending each post as soon as its page has been decoded.
+// It starts after the post with fullname after ("" for the newest) and
+// stops after max fetched posts (0 means the whole listing). Posts rejected
+// by keep are dropped before they are sent; keep runs on the streaming
+// goroutine, so it must not read state the consumer modifies. Both channels
+// are closed when streaming ends; at most one error is sent.
+func (r *Client) StreamListing(ctx context.Context, username, listing string, pageSize, max int, after string, keep PostFilter) (<-chan Post, <-chan error) {
+	postsCh := make(chan Post)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(postsCh)
+		defer close(errCh)
+		fetched := 0
+		for {
+			limit := pageSize
+			if max > 0 && max-fetched < limit {
+				limit = max - fetched
+			}
+			posts, n, next, err := r.fetchListingPage(ctx, username, listing, limit, after, keep)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			fetched += n
+			for _, post := range posts {
+				select {
+				case postsCh <- post:
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				}
+			}
+			if max > 0 && fetched >= max {
+				return
+			}
+			if next == "" {
+				return
+			}
+			after = next
+		}
+	}()
+	return postsCh, errCh
+}
+
+// fetchListingPage requests a single page of a listing starting after the
+// given fullname. It returns the posts accepted by keep (all when keep
+// is nil), the number of posts on the page and the cursor of the next page.
+// Transient responses are retried up to SoftLimitRetries times.
+func (r *Client) fetchListingPage(ctx context.Context, username, listing string, limit int, after string, keep PostFilter) ([]Post, int, string, error) {
+	delay := softLimitBackoff
+	for attempt := 0; ; attempt++ {
+		posts, n, next, err := r.fetchListingPageOnce(ctx, username, listing, limit, after, keep)
+		if err == nil || !errors.Is(err, ErrTransient) || attempt >= r.SoftLimitRetries {
+			return posts, n, next, err
+		}
+		slog.Warn("Reddit returned a transient response, retrying", "error", err, "wait", delay)
+		if !timeutil.Sleep(ctx, delay) {
+			return nil, 0, "", ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func (r *Client) fetchListingPageOnce(ctx context.Context, username, listing string, limit int, after string, keep PostFilter) ([]Post, int, string, error) {
+	query := neturl.Values{"limit": {strconv.Itoa(limit)}, "sort": {"new"}}
+	if after != "" {
+		query.Set("after", after)
+	}
+	url := r.BaseURL + "/user/" + neturl.PathEscape(username) + "/" + neturl.PathEscape(listing) + "?" + query.Encode()
+	resp, err := r.get(ctx, url)
+	if err != nil {
+		if ctx.Err() == nil && !errors.Is(err, ErrInvalidGrant) {
+			// A network failure, or the token endpoint being unreachable
+			err = fmt.Errorf("%w: %w", ErrTransient, err)
+		}
+		return nil, 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("%w: failed to read response: %w", ErrTransient, err)
+	}
+	if err := checkChallenge(resp, body); err != nil {
+		return nil, 0, "", err
+	}
+	if resp.StatusCode >= 500 {
+		return nil, 0, "", fmt.Errorf("%w: Reddit API error: %s", ErrTransient, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, "", fmt.Errorf("Reddit API error: %s, Body: %s", resp.Status, string(body))
+	}
+	if err := checkListingBody(body); err != nil {
+		return nil, 0, "", err
+	}
+	var redditResp Listing
+	if err := json.Unmarshal(body, &redditResp); err != nil {
+		return nil, 0, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	var posts []Post
+	for _, child := range redditResp.Data.Children {
+		post := child.Data
+		post.FullID = child.Kind + "_" + post.ID
+		post.IsComment = (child.Kind == "t1")
+		post.Source = listing
+		if keep != nil && !keep(post) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+	return posts, len(redditResp.Data.Children), redditResp.Data.After, nil
+}
+
+// challengeMarkers appear in Cloudflare challenge pages
+var challengeMarkers = []string{"cf-chl", "challenge-platform", "Just a moment...", "cf_chl_opt"}
+
+// get sends an authenticated GET request. A 401 means the access token
+// expired or was revoked early; the token is then refreshed and the request
+// sent once more. Rate limits are honored: after a response that used up
+// the window the next request waits for it to reset, and a 429 is retried
+// up to RateLimitRetries times once the window resets.
+func (r *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	return r.do(ctx, "GET", url, nil)
+}
+
+// postForm sends an authenticated form POST request, handled like get
+func (r *Client) postForm(ctx context.Context, url string, form neturl.Values) (*http.Response, error) {
+	return r.do(ctx, "POST", url, form)
+}
+
+func (r *Client) do(ctx context.Context, method, url string, form neturl.Values) (*http.Response, error) {
+	reauthenticated := false
+	for limited := 0; ; {
+		if wait := time.Until(r.pauseUntil); wait > 0 {
+			slog.Warn("Reddit rate limit used up, waiting for it to reset", "wait", wait.Round(time.Second))
+			if !timeutil.Sleep(ctx, wait) {
+				return nil, ctx.Err()
+			}
+		}
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Set("User-Agent", r.UserAgent)
+		Requests.Add(1)
+		resp, err := r.HTTPClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", classifyAuthError(err))
+		}
+		reset, exhausted := rateLimitReset(resp.Header)
+		if exhausted || resp.StatusCode == http.StatusTooManyRequests {
+			r.pauseUntil = time.Now().Add(reset)
+		}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && limited < r.RateLimitRetries:
+			resp.Body.Close()
+			limited++
+		case resp.StatusCode == http.StatusUnauthorized && !reauthenticated && r.tokenSource != nil:
+			resp.Body.Close()
+			slog.Warn("Reddit rejected the access token (401), refreshing it")
+			r.Reauthenticate()
+			reauthenticated = true
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// unsavePath removes an item from the saved listing
+const unsavePath = "/api/unsave"
+
+// Unsave removes the post or comment with the given fullname from the
+// user's saved items
+func (r *Client) Unsave(ctx context.Context, fullID string) error {
+	resp, err := r.postForm(ctx, r.BaseURL+unsavePath, neturl.Values{"id": {fullID}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := checkChallenge(resp, body); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Reddit API error: %s, Body: %s", resp.Status, string(body))
+	}
+	return nil
+}
+
+// rateLimitReset reads how long until the rate limit window resets, from
+// Retry-After or X-Ratelimit-Reset (both in seconds), and whether
+// X-Ratelimit-Remaining says the window is used up. Without a usable
+// header, one minute is assumed.
+func rateLimitReset(h http.Header) (time.Duration, bool) {
+	exhausted := false
+	if remaining, err := strconv.ParseFloat(h.Get("X-Ratelimit-Remaining"), 64); err == nil && remaining < 1 {
+		exhausted = true
+	}
+	for _, name := range []string{"Retry-After", "X-Ratelimit-Reset"} {
+		if seconds, err := strconv.ParseFloat(h.Get(name), 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), exhausted
+		}
+	}
+	return time.Minute, exhausted
+}
+
+// checkChallenge detects an HTML page where JSON was expected, typically a
+// Cloudflare challenge sent with 403 or 503, and reports it as
+// ErrChallenge, which is retried like other transient responses
+func checkChallenge(resp *http.Response, body []byte) error {
+	mediaType := strings.ToLower(resp.Header.Get("Content-Type"))
+	challenge := resp.Header.Get("Cf-Mitigated") == "challenge"
+	for _, marker := range challengeMarkers {
+		if bytes.Contains(body, []byte(marker)) {
+			challenge = true
+			break
+		}
+	}
+	if !challenge && !strings.HasPrefix(mediaType, "text/html") {
+		return nil
+	}
+	if !challenge {
+		return fmt.Errorf("%w: unexpected %s response (%s)", ErrTransient, mediaType, resp.Status)
+	}
+	return fmt.Errorf("%w: %w (%s)", ErrTransient, ErrChallenge, resp.Status)
+}
+
+// checkListingBody detects the soft rate limiting Reddit does under load,
+// answering 200 with an empty body, JSON of another kind than a Listing or
+// one without data.children, and reports it as ErrTransient. An empty
+// listing has an empty children array and is accepted.
+func checkListingBody(body []byte) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fmt.Errorf("%w: empty body", ErrTransient)
+	}
+	var probe struct {
+		Kind string `json:"kind"`
+		Data *struct {
+			Children json.RawMessage `json:"children"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		// Not a soft limit, let the real decode report the error
+		return nil
+	}
+	if probe.Kind != "Listing" {
+		return fmt.Errorf("%w: expected a Listing, got kind %q", ErrTransient, probe.Kind)
+	}
+	if probe.Data == nil || len(probe.Data.Children) == 0 || string(probe.Data.Children) == "null" {
+		return fmt.Errorf("%w: listing has no data.children", ErrTransient)
+	}
+	return nil
+}
+
+// OAuthContext makes the oauth2 package fetch tokens through transport,
+// each request limited to timeout
+func OAuthContext(ctx context.Context, transport http.RoundTripper, timeout time.Duration) context.Context {
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
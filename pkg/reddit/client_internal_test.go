@@ -0,0 +1,75 @@
+package reddit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/internal/cassette"
+)
+
+// newCassetteClient returns a client replaying a cassette in testdata, with
+// retry delays shortened for the test
+func newCassetteClient(t *testing.T, name string) *Client {
+	t.Helper()
+	backoff := softLimitBackoff
+	softLimitBackoff = time.Millisecond
+	t.Cleanup(func() { softLimitBackoff = backoff })
+
+	srv := cassette.Replay(t, "testdata/"+name)
+	client, err := NewClient("test-client", cassette.Redacted, http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+	return client
+}
+
+func TestSoftLimitRetried(t *testing.T) {
+	client := newCassetteClient(t, "soft_limit.json")
+	posts, err := client.GetListing(context.Background(), "alice", ListingSaved, 25)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if len(posts) != 1 || posts[0].FullID != "t3_1akz9q3" {
+		t.Errorf("posts = %+v", posts)
+	}
+}
+
+func TestSoftLimitGivesUp(t *testing.T) {
+	client := newCassetteClient(t, "soft_limit.json")
+	client.SoftLimitRetries = 2
+	_, err := client.GetListing(context.Background(), "alice", ListingSaved, 25)
+	if !errors.Is(err, ErrTransient) {
+		t.Fatalf("GetListing error = %v, want ErrTransient", err)
+	}
+	// The next cycle gets the listing
+	if _, err := client.GetListing(context.Background(), "alice", ListingSaved, 25); err != nil {
+		t.Fatalf("GetListing after giving up: %v", err)
+	}
+}
+
+func TestCheckListingBody(t *testing.T) {
+	tests := []struct {
+		body      string
+		transient bool
+	}{
+		{``, true},
+		{"  \n", true},
+		{`{"kind":"t2","data":{}}`, true},
+		{`{"kind":"Listing","data":{"after":null}}`, true},
+		{`{"kind":"Listing","data":{"children":null}}`, true},
+		{`{"kind":"Listing","data":{"children":[]}}`, false},
+		{`{"kind":"Listing","data":{"children":[{"kind":"t3","data":{}}]}}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		err := checkListingBody([]byte(tt.body))
+		if errors.Is(err, ErrTransient) != tt.transient {
+			t.Errorf("checkListingBody(%q) = %v, want transient %v", tt.body, err, tt.transient)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package reddit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// newTestClient returns a client whose API and token requests both go to a
+// server that hands out a token and passes everything else to handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *reddit.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"test-access","token_type":"bearer","expires_in":3600,"scope":"history identity read save"}`)
+	})
+	mux.HandleFunc("/", handler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+	return client
+}
+
+func TestGetListing(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/alice/saved" {
+			t.Errorf("path = %q, want /user/alice/saved", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-access" {
+			t.Errorf("Authorization = %q, want the refreshed access token", got)
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[
+			{"kind":"t3","data":{"id":"p1","title":"A post","subreddit":"golang","permalink":"/r/golang/comments/p1/a_post/"}},
+			{"kind":"t1","data":{"id":"c1","body":"A comment","subreddit":"golang","link_id":"t3_p1"}}]}}`)
+	})
+
+	posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("got %d posts, want 2", len(posts))
+	}
+	if posts[0].FullID != "t3_p1" || posts[0].IsComment || posts[0].Source != reddit.ListingSaved {
+		t.Errorf("post = %+v", posts[0])
+	}
+	if posts[1].FullID != "t1_c1" || !posts[1].IsComment {
+		t.Errorf("comment = %+v", posts[1])
+	}
+}
+
+func TestGetListingUnexpectedBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"HTML error page", "text/html; charset=utf-8", `<html><body><h1>Our CDN was unable to reach our servers</h1></body></html>`},
+		{"other kind", "application/json", `{"kind":"t2","data":{"name":"alice"}}`},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			io.WriteString(w, tt.body)
+		})
+		client.SoftLimitRetries = 0
+
+		posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+		if !errors.Is(err, reddit.ErrTransient) {
+			t.Errorf("%s: GetListing = %d posts, error %v, want ErrTransient", tt.name, len(posts), err)
+		}
+	}
+}
+
+func TestGetListingEmpty(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"dist":0,"children":[]}}`)
+	})
+
+	posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+	if err != nil || len(posts) != 0 {
+		t.Errorf("GetListing = %+v, %v, want an empty listing accepted", posts, err)
+	}
+}
+
+func TestUnsave(t *testing.T) {
+	var unsaved string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/unsave" {
+			t.Errorf("request = %s %s, want POST /api/unsave", r.Method, r.URL.Path)
+		}
+		unsaved = r.FormValue("id")
+		io.WriteString(w, `{}`)
+	})
+
+	if err := client.Unsave(context.Background(), "t3_p1"); err != nil {
+		t.Fatalf("Unsave: %v", err)
+	}
+	if unsaved != "t3_p1" {
+		t.Errorf("unsaved id = %q, want t3_p1", unsaved)
+	}
+}
+
+func TestGetListingFollowsAfter(t *testing.T) {
+	var afters []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		after := r.URL.Query().Get("after")
+		afters = append(afters, after)
+		if after == "" {
+			io.WriteString(w, `{"kind":"Listing","data":{"after":"t3_p2","children":[
+				{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}},
+				{"kind":"t3","data":{"id":"p2","title":"Two","subreddit":"golang","permalink":"/r/golang/comments/p2/two/"}}]}}`)
+			return
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[
+			{"kind":"t3","data":{"id":"p3","title":"Three","subreddit":"golang","permalink":"/r/golang/comments/p3/three/"}}]}}`)
+	})
+
+	posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	var ids []string
+	for _, post := range posts {
+		ids = append(ids, post.FullID)
+	}
+	if got := strings.Join(ids, ","); got != "t3_p1,t3_p2,t3_p3" {
+		t.Errorf("posts = %s, want both pages", got)
+	}
+	if got := strings.Join(afters, ","); got != ",t3_p2" {
+		t.Errorf("after = %q, want the first page's cursor on the second request", afters)
+	}
+
+	// The total cap stops before the second page
+	afters = nil
+	posts, err = client.GetListing(context.Background(), "alice", reddit.ListingSaved, 2)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if len(posts) != 2 || len(afters) != 1 {
+		t.Errorf("got %d posts in %d requests, want 2 in 1", len(posts), len(afters))
+	}
+}
+
+func TestGetListingEscapesURL(t *testing.T) {
+	var path, after, limit string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path, after, limit = r.URL.EscapedPath(), r.URL.Query().Get("after"), r.URL.Query().Get("limit")
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[]}}`)
+	})
+
+	posts, errs := client.StreamListing(context.Background(), "a/b?c", reddit.ListingSaved, 10, 0, "t3_x&limit=1", nil)
+	for range posts {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("StreamListing: %v", err)
+	}
+	if path != "/user/a%2Fb%3Fc/saved" {
+		t.Errorf("path = %q, want the username escaped as one segment", path)
+	}
+	if after != "t3_x&limit=1" || limit != "10" {
+		t.Errorf("after = %q, limit = %q, want the cursor kept as one value", after, limit)
+	}
+}
+
+func TestGetListingReauthenticatesAfter401(t *testing.T) {
+	tokens := 0
+	listings := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"bearer","expires_in":3600}`, tokens)
+	})
+	mux.HandleFunc("/user/alice/saved", func(w http.ResponseWriter, r *http.Request) {
+		listings++
+		if r.Header.Get("Authorization") != "Bearer access-2" {
+			// The first token expired early
+			http.Error(w, `{"message":"Unauthorized","error":401}`, http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[
+			{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}}]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+
+	posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if len(posts) != 1 || posts[0].FullID != "t3_p1" {
+		t.Errorf("posts = %+v, want t3_p1", posts)
+	}
+	if tokens != 2 || listings != 2 {
+		t.Errorf("%d token and %d listing requests, want 2 each", tokens, listings)
+	}
+}
+
+func TestGetListingReauthenticatesOnce(t *testing.T) {
+	tokens, listings := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"bearer","expires_in":3600}`, tokens)
+	})
+	mux.HandleFunc("/user/alice/saved", func(w http.ResponseWriter, r *http.Request) {
+		listings++
+		// Revoked: every token is rejected
+		http.Error(w, `{"message":"Unauthorized","error":401}`, http.StatusUnauthorized)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+
+	if _, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0); err == nil {
+		t.Fatal("GetListing succeeded although every token was rejected")
+	}
+	if tokens != 2 || listings != 2 {
+		t.Errorf("%d token and %d listing requests, want a single refresh and retry", tokens, listings)
+	}
+}
+
+func TestGetListingWaitsOutRateLimit(t *testing.T) {
+	var requests []time.Time
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		if len(requests) == 1 {
+			w.Header().Set("Retry-After", "0.2")
+			w.Header().Set("X-Ratelimit-Remaining", "0")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[]}}`)
+	})
+
+	if _, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0); err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want the 429 retried once", len(requests))
+	}
+	if wait := requests[1].Sub(requests[0]); wait < 200*time.Millisecond {
+		t.Errorf("retried after %s, before Retry-After", wait)
+	}
+}
+
+func TestGetListingRateLimitRetriesCapped(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	})
+	client.RateLimitRetries = 2
+
+	if _, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0); err == nil {
+		t.Fatal("GetListing succeeded although every request was rate limited")
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want the first and 2 retries", requests)
+	}
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	var form neturl.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"test-access","token_type":"bearer","expires_in":3600}`)
+	})
+	mux.HandleFunc("/user/alice/saved", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client, err := reddit.NewClient("test-client", "saved-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+
+	if _, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0); err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	if form.Get("grant_type") != "refresh_token" || form.Get("refresh_token") != "saved-refresh" {
+		t.Errorf("token request = %v, want the refresh token grant", form)
+	}
+}
+
+func TestGetListingBothListings(t *testing.T) {
+	for _, listing := range []string{reddit.ListingSaved, reddit.ListingUpvoted} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if want := "/user/alice/" + listing; r.URL.Path != want {
+				t.Errorf("path = %q, want %s", r.URL.Path, want)
+			}
+			io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[
+				{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}}]}}`)
+		})
+		posts, err := client.GetListing(context.Background(), "alice", listing, 0)
+		if err != nil {
+			t.Fatalf("GetListing(%s): %v", listing, err)
+		}
+		if len(posts) != 1 || posts[0].FullID != "t3_p1" || posts[0].Source != listing {
+			t.Errorf("%s: posts = %+v", listing, posts)
+		}
+	}
+}
+
+func TestLooksLikeBrowser(t *testing.T) {
+	for userAgent, want := range map[string]bool{
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36": true,
+		"script:reddit2dynalist:v1.2.0 (by /u/alice)":        false,
+	} {
+		if got := reddit.LooksLikeBrowser(userAgent); got != want {
+			t.Errorf("LooksLikeBrowser(%q) = %v, want %v", userAgent, got, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package reddit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew returns how far the local clock is ahead of the server's Date
+// header (negative when behind). ok is false when the header is missing or
+// can't be parsed.
+func clockSkew(resp *http.Response, now time.Time) (skew time.Duration, ok bool) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(date), true
+}
+
+// CheckClockSkew compares the local clock against the server at authBaseURL,
+// which issues the tokens whose expiry the skew would throw off. It is
+// requested without credentials, so the check works even when
+// authentication is broken. The Date header has one-second resolution, so
+// small differences are meaningless.
+func CheckClockSkew(ctx context.Context, transport http.RoundTripper, authBaseURL string) (time.Duration, error) {
+	url := strings.TrimRight(authBaseURL, "/") + "/"
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+	skew, ok := clockSkew(resp, time.Now())
+	if !ok {
+		return 0, fmt.Errorf("response has no usable Date header")
+	}
+	return skew, nil
+}
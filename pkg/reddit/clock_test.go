@@ -0,0 +1,44 @@
+package reddit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestCheckClockSkew(t *testing.T) {
+	var method, path, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		// The server's clock runs five minutes behind
+		w.Header().Set("Date", time.Now().Add(-5*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	skew, err := reddit.CheckClockSkew(context.Background(), http.DefaultTransport, srv.URL+"/")
+	if err != nil {
+		t.Fatalf("CheckClockSkew: %v", err)
+	}
+	if method != http.MethodHead || path != "/" || auth != "" {
+		t.Errorf("request = %s %s with Authorization %q, want an anonymous HEAD of the overridden host", method, path, auth)
+	}
+	if skew < 4*time.Minute || skew > 6*time.Minute {
+		t.Errorf("skew = %s, want about 5m", skew)
+	}
+}
+
+func TestCheckClockSkewWithoutDate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Go's server adds a Date header unless it is explicitly removed
+		w.Header()["Date"] = nil
+	}))
+	defer srv.Close()
+
+	if _, err := reddit.CheckClockSkew(context.Background(), http.DefaultTransport, srv.URL); err == nil {
+		t.Error("CheckClockSkew succeeded without a Date header")
+	}
+}
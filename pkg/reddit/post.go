@@ -0,0 +1,215 @@
+package reddit
+
+import (
+	"encoding/json"
+	"log/slog"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Post represents a saved post or comment from Reddit
+type Post struct {
+	Kind      string  `json:"kind"`
+	ID        string  `json:"id"`
+	FullID    string  `json:"name"`
+	Title     string  `json:"title,omitempty"`
+	Author    string  `json:"author"`
+	Subreddit string  `json:"subreddit"`
+	Permalink string  `json:"permalink"`
+	URL       string  `json:"url,omitempty"`
+	Created   float64 `json:"created_utc"`
+	IsComment bool    `json:"-"` // Internal field
+	// Source is the listing the post was fetched from, ListingSaved or
+	// ListingUpvoted
+	Source string `json:"-"`
+
+	// Text of self posts and comments respectively, empty otherwise
+	Selftext string `json:"selftext,omitempty"`
+	Body     string `json:"body,omitempty"`
+
+	// Score when the post was fetched; NumComments is nil for comments
+	Score       int  `json:"score"`
+	NumComments *int `json:"num_comments,omitempty"`
+
+	// Only set for comments
+	LinkID        string `json:"link_id,omitempty"`
+	LinkPermalink string `json:"link_permalink,omitempty"`
+
+	// Kept raw since media objects vary in shape between providers
+	IsVideo     bool            `json:"is_video,omitempty"`
+	Media       json.RawMessage `json:"media,omitempty"`
+	SecureMedia json.RawMessage `json:"secure_media,omitempty"`
+
+	// permalinkURL replaces the permalink when Reddit sent none, see
+	// ResolvePermalink
+	permalinkURL string
+
+	// Only set for crossposts, the first entry is the original post
+	CrosspostParentList []struct {
+		Subreddit string `json:"subreddit"`
+	} `json:"crosspost_parent_list,omitempty"`
+}
+
+// OriginSubreddit returns the subreddit a crosspost was originally posted
+// to, or the post's own subreddit for anything else
+func (p Post) OriginSubreddit() string {
+	if len(p.CrosspostParentList) > 0 && p.CrosspostParentList[0].Subreddit != "" {
+		return p.CrosspostParentList[0].Subreddit
+	}
+	return p.Subreddit
+}
+
+// CreatedTime returns the post's creation time from created_utc
+func (p Post) CreatedTime() time.Time {
+	sec := int64(p.Created)
+	return time.Unix(sec, int64((p.Created-float64(sec))*1e9)).UTC()
+}
+
+// media is the part of a media object describing a Reddit-hosted video
+type media struct {
+	RedditVideo *struct {
+		FallbackURL string `json:"fallback_url"`
+	} `json:"reddit_video"`
+}
+
+// VideoURL returns the direct link of a Reddit-hosted video, preferring
+// secure_media over media. ok is false for non-video posts and when the
+// media objects can't be parsed.
+func (p Post) VideoURL() (url string, ok bool) {
+	if !p.IsVideo {
+		return "", false
+	}
+	for _, raw := range []json.RawMessage{p.SecureMedia, p.Media} {
+		if len(raw) == 0 {
+			continue
+		}
+		var media media
+		if err := json.Unmarshal(raw, &media); err != nil {
+			continue
+		}
+		if media.RedditVideo != nil && media.RedditVideo.FallbackURL != "" {
+			return media.RedditVideo.FallbackURL, true
+		}
+	}
+	return "", false
+}
+
+// PermalinkURL returns the absolute link to the post or comment. Without a
+// permalink it is built from the IDs, which Reddit redirects to the thread.
+func (p Post) PermalinkURL() string {
+	if p.permalinkURL != "" {
+		return p.permalinkURL
+	}
+	if link, ok := canonicalPermalink(p.Permalink); ok {
+		return link
+	}
+	if p.IsComment {
+		if link := strings.TrimPrefix(p.LinkID, "t3_"); link != "" {
+			return "https://reddit.com/comments/" + link + "/_/" + p.ID + "/"
+		}
+	}
+	return "https://reddit.com/comments/" + p.ID + "/"
+}
+
+// canonicalPermalink turns a permalink into an absolute Reddit URL. Reddit
+// sends paths like "/r/golang/comments/abc123/...", but absolute Reddit URLs
+// and paths without the leading slash are accepted too. ok is false for an
+// empty permalink or one on another host.
+func canonicalPermalink(permalink string) (link string, ok bool) {
+	permalink = strings.TrimSpace(permalink)
+	if permalink == "" {
+		return "", false
+	}
+	if strings.HasPrefix(permalink, "//") {
+		permalink = "https:" + permalink
+	}
+	if strings.Contains(permalink, "://") {
+		u, err := neturl.Parse(permalink)
+		if err != nil || !isRedditHost(u.Hostname()) {
+			return "", false
+		}
+		return permalink, true
+	}
+	if !strings.HasPrefix(permalink, "/") {
+		permalink = "/" + permalink
+	}
+	return "https://reddit.com" + permalink, true
+}
+
+// isRedditHost reports whether host is reddit.com or one of its subdomains
+func isRedditHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "reddit.com" || strings.HasSuffix(host, ".reddit.com")
+}
+
+// How a post without a usable permalink is linked, see ResolvePermalink
+const (
+	MissingPermalinkConstruct = "construct"
+	MissingPermalinkURL       = "url"
+	MissingPermalinkSkip      = "skip"
+)
+
+// ResolvePermalink applies a MissingPermalink* mode to a post without a
+// usable permalink, see canonicalPermalink. ok is false when the post should
+// be skipped.
+func (p *Post) ResolvePermalink(mode string) (ok bool) {
+	if _, usable := canonicalPermalink(p.Permalink); usable {
+		return true
+	}
+	switch mode {
+	case MissingPermalinkSkip:
+		slog.Warn("Post has no usable permalink, skipping it", "post_id", p.FullID, "permalink", p.Permalink)
+		return false
+	case MissingPermalinkURL:
+		if p.URL != "" {
+			p.permalinkURL = p.URL
+			break
+		}
+		fallthrough
+	default:
+		p.permalinkURL = p.PermalinkURL()
+	}
+	slog.Warn("Post has no usable permalink, linking a substitute", "post_id", p.FullID, "permalink", p.Permalink, "link", p.permalinkURL)
+	return true
+}
+
+// SubmissionURL returns the link to the submission a comment belongs to,
+// or "" when Reddit did not provide enough information to build it
+func (p Post) SubmissionURL() string {
+	if p.LinkPermalink != "" {
+		return p.LinkPermalink
+	}
+	if id := strings.TrimPrefix(p.LinkID, "t3_"); id != "" {
+		return "https://reddit.com/comments/" + id + "/"
+	}
+	return ""
+}
+
+// ExternalURL returns the page a link post points to, or "" for self posts,
+// comments and posts linking back to Reddit, e.g. crossposts
+func (p Post) ExternalURL() string {
+	if p.IsComment || p.URL == "" {
+		return ""
+	}
+	u, err := neturl.Parse(p.URL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if isRedditHost(u.Hostname()) {
+		return ""
+	}
+	return p.URL
+}
+
+// Listing represents the response from Reddit API
+type Listing struct {
+	Kind string `json:"kind"`
+	Data struct {
+		Children []struct {
+			Kind string `json:"kind"`
+			Data Post   `json:"data"`
+		} `json:"children"`
+		After string `json:"after"`
+	} `json:"data"`
+}
@@ -0,0 +1,122 @@
+package reddit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestPostLinks(t *testing.T) {
+	comment := reddit.Post{
+		ID:        "c1",
+		IsComment: true,
+		Permalink: "/r/golang/comments/p1/a_post/c1/",
+		LinkID:    "t3_p1",
+	}
+	if got, want := comment.PermalinkURL(), "https://reddit.com/r/golang/comments/p1/a_post/c1/"; got != want {
+		t.Errorf("PermalinkURL() = %q, want %q", got, want)
+	}
+	if got, want := comment.SubmissionURL(), "https://reddit.com/comments/p1/"; got != want {
+		t.Errorf("SubmissionURL() = %q, want %q", got, want)
+	}
+
+	link := reddit.Post{ID: "p2", URL: "https://go.dev/blog"}
+	if got := link.ExternalURL(); got != "https://go.dev/blog" {
+		t.Errorf("ExternalURL() = %q, want the linked page", got)
+	}
+	crosspost := reddit.Post{ID: "p3", URL: "https://www.reddit.com/r/golang/comments/p1/"}
+	if got := crosspost.ExternalURL(); got != "" {
+		t.Errorf("ExternalURL() of a crosspost = %q, want none", got)
+	}
+}
+
+func TestPermalinkForms(t *testing.T) {
+	tests := []struct {
+		name, permalink, want string
+	}{
+		{"relative with leading slash", "/r/golang/comments/p1/a_post/", "https://reddit.com/r/golang/comments/p1/a_post/"},
+		{"relative without slash", "r/golang/comments/p1/a_post/", "https://reddit.com/r/golang/comments/p1/a_post/"},
+		{"absolute", "https://www.reddit.com/r/golang/comments/p1/a_post/", "https://www.reddit.com/r/golang/comments/p1/a_post/"},
+		{"protocol-relative", "//old.reddit.com/r/golang/comments/p1/a_post/", "https://old.reddit.com/r/golang/comments/p1/a_post/"},
+		{"empty", "", "https://reddit.com/comments/p1/"},
+		{"whitespace", "  ", "https://reddit.com/comments/p1/"},
+		{"foreign host", "https://example.com/r/golang/comments/p1/", "https://reddit.com/comments/p1/"},
+	}
+	for _, tt := range tests {
+		post := reddit.Post{ID: "p1", Permalink: tt.permalink}
+		if got := post.PermalinkURL(); got != tt.want {
+			t.Errorf("%s: PermalinkURL() of %q = %q, want %q", tt.name, tt.permalink, got, tt.want)
+		}
+	}
+}
+
+// noPermalinkPosts fetches the posts of testdata/no_permalink.json, none of
+// which has a usable permalink
+func noPermalinkPosts(t *testing.T) []reddit.Post {
+	t.Helper()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/no_permalink.json")
+	})
+	posts, err := client.GetListing(context.Background(), "alice", reddit.ListingSaved, 0)
+	if err != nil {
+		t.Fatalf("GetListing: %v", err)
+	}
+	return posts
+}
+
+func TestResolvePermalink(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{reddit.MissingPermalinkConstruct, []string{
+			"https://reddit.com/comments/p1/",
+			"https://reddit.com/comments/p2/_/c1/",
+			"https://reddit.com/comments/p3/",
+		}},
+		{reddit.MissingPermalinkURL, []string{
+			"https://go.dev/blog/",
+			"https://reddit.com/comments/p2/_/c1/",
+			"https://reddit.com/comments/p3/",
+		}},
+		{reddit.MissingPermalinkSkip, []string{"", "", ""}},
+	}
+	for _, tt := range tests {
+		for i, post := range noPermalinkPosts(t) {
+			ok := post.ResolvePermalink(tt.mode)
+			if ok != (tt.want[i] != "") {
+				t.Errorf("%s: ResolvePermalink(%s) = %v", tt.mode, post.FullID, ok)
+				continue
+			}
+			if ok && post.PermalinkURL() != tt.want[i] {
+				t.Errorf("%s: PermalinkURL(%s) = %q, want %q", tt.mode, post.FullID, post.PermalinkURL(), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCreatedTime(t *testing.T) {
+	tests := []struct {
+		json string
+		want time.Time
+	}{
+		{`{"created_utc":1707138000}`, time.Date(2024, 2, 5, 13, 0, 0, 0, time.UTC)},
+		{`{"created_utc":1707138000.5}`, time.Date(2024, 2, 5, 13, 0, 0, 500e6, time.UTC)},
+		{`{"created_utc":1707138000.123}`, time.Date(2024, 2, 5, 13, 0, 0, 123e6, time.UTC)},
+	}
+	for _, tt := range tests {
+		var post reddit.Post
+		if err := json.Unmarshal([]byte(tt.json), &post); err != nil {
+			t.Fatalf("failed to decode %s: %v", tt.json, err)
+		}
+		got := post.CreatedTime()
+		// created_utc is a float64, exact to well under a microsecond
+		if diff := got.Sub(tt.want); diff < -time.Microsecond || diff > time.Microsecond || got.Location() != time.UTC {
+			t.Errorf("CreatedTime() of %s = %s, want %s", tt.json, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// inboxSink names the Dynalist inbox destination in cache entries
+const inboxSink = "dynalist:inbox"
+
+// ErrLocked is returned when another process holds the cache lock
+var ErrLocked = errors.New("cache file is locked by another process")
+
+// CacheEntry records when a post was first seen and which sinks received it
+type CacheEntry struct {
+	Seen      time.Time            `json:"seen"`
+	Delivered map[string]time.Time `json:"delivered,omitempty"`
+
+	// Display details, used by sinks that render from the cache
+	Title     string `json:"title,omitempty"`
+	Link      string `json:"link,omitempty"`
+	Subreddit string `json:"subreddit,omitempty"`
+
+	// Nodes maps Dynalist sinks to the ID of the node created for the post
+	Nodes map[string]string `json:"nodes,omitempty"`
+
+	// MergedInto is set when the post was collapsed into an earlier
+	// duplicate of the same cycle instead of being delivered
+	MergedInto string `json:"merged_into,omitempty"`
+}
+
+// UnmarshalJSON also accepts the legacy format, where an entry was just the
+// time the post was sent to the inbox
+func (e *CacheEntry) UnmarshalJSON(data []byte) error {
+	var seen time.Time
+	if err := json.Unmarshal(data, &seen); err == nil {
+		e.Seen = seen
+		e.Delivered = map[string]time.Time{inboxSink: seen}
+		return nil
+	}
+	type plain CacheEntry
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// Cache stores post IDs to avoid duplicates. Its methods are safe for
+// concurrent use; fields must not be accessed directly while other
+// goroutines use the cache.
+type Cache struct {
+	mu sync.RWMutex
+
+	Posts map[string]*CacheEntry
+	// FirstRuns holds when the first cycle of each job succeeded, see
+	// Started
+	FirstRuns map[string]time.Time
+	// Since is the first run of caches written before FirstRuns, which
+	// had one for all jobs
+	Since time.Time
+	// Backfill holds the progress of BACKFILL per job, keyed by listingKey
+	Backfill map[string]BackfillState `json:",omitempty"`
+	// Headings holds the date heading of the current period per sink
+	Headings map[string]HeadingNode `json:",omitempty"`
+
+	// Pretty makes SaveToFile write indented JSON
+	Pretty bool `json:"-"`
+	// MaxSize makes SaveToFile drop the oldest entries until the file fits,
+	// 0 means unbounded
+	MaxSize int64 `json:"-"`
+	// DedupTTL limits how long a delivery counts as "already synced",
+	// 0 means as long as the entry is cached
+	DedupTTL time.Duration `json:"-"`
+	// ReadOnly makes SaveToFile do nothing, for dry runs
+	ReadOnly bool `json:"-"`
+
+	// legacy is set for caches loaded without FirstRuns, see Started
+	legacy bool
+}
+
+// BackfillState is how far a backfill of the whole saved listing got.
+// After is the fullname of the last handled post, the listing cursor a
+// restarted backfill resumes from.
+type BackfillState struct {
+	After   string `json:",omitempty"`
+	Handled int
+	Done    bool
+}
+
+// BackfillFor returns a copy of the backfill progress of a job, the zero
+// state when none was recorded
+func (c *Cache) BackfillFor(key string) BackfillState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Backfill[key]
+}
+
+// SetBackfill records the backfill progress of a job
+func (c *Cache) SetBackfill(key string, state BackfillState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Backfill == nil {
+		c.Backfill = make(map[string]BackfillState)
+	}
+	c.Backfill[key] = state
+}
+
+// HeadingNode is a date heading created in the Dynalist document
+type HeadingNode struct {
+	Heading string
+	NodeID  string
+}
+
+// SetHeading records the sink's heading for the current period
+func (c *Cache) SetHeading(sink, heading, nodeID string) {
+	if nodeID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Headings == nil {
+		c.Headings = make(map[string]HeadingNode)
+	}
+	c.Headings[sink] = HeadingNode{Heading: heading, NodeID: nodeID}
+}
+
+// HeadingFor returns the sink's heading for the current period, if any
+func (c *Cache) HeadingFor(sink string) (HeadingNode, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	h, ok := c.Headings[sink]
+	return h, ok
+}
+
+// NewCache returns an empty cache
+func NewCache() *Cache {
+	return &Cache{Posts: make(map[string]*CacheEntry), FirstRuns: make(map[string]time.Time)}
+}
+
+// IsEmpty reports whether nothing was ever recorded, i.e. this is a first run
+func (c *Cache) IsEmpty() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.Posts) == 0 && len(c.FirstRuns) == 0 && c.Since.IsZero()
+}
+
+// Started returns when the first cycle of a job succeeded, keyed by
+// listingKey, and whether it has. In caches written before this was
+// recorded a job counts as started when its sink has deliveries.
+func (c *Cache) Started(key, sink string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if t, ok := c.FirstRuns[key]; ok {
+		return t, true
+	}
+	if !c.legacy {
+		return time.Time{}, false
+	}
+	for _, entry := range c.Posts {
+		if _, ok := entry.Delivered[sink]; ok {
+			return c.Since, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SetStarted records when the first cycle of a job succeeded, unless one
+// is already recorded
+func (c *Cache) SetStarted(key string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.FirstRuns[key]; ok {
+		return
+	}
+	c.FirstRuns[key] = t
+}
+
+// IsDelivered reports whether the post was sent to the sink within DedupTTL
+func (c *Cache) IsDelivered(id, sink string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.Posts[id]
+	return ok && c.deliveredRecently(entry, sink, time.Now())
+}
+
+// DeliveredIDs returns a snapshot of the IDs IsDelivered reports for the sink
+func (c *Cache) DeliveredIDs(sink string) map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	ids := make(map[string]bool, len(c.Posts))
+	for id, entry := range c.Posts {
+		if c.deliveredRecently(entry, sink, now) {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+func (c *Cache) deliveredRecently(entry *CacheEntry, sink string, now time.Time) bool {
+	at, ok := entry.Delivered[sink]
+	if !ok {
+		return false
+	}
+	return c.DedupTTL <= 0 || now.Sub(at) <= c.DedupTTL
+}
+
+// MarkDelivered records that the post was sent to the sink at time t
+func (c *Cache) MarkDelivered(id, sink string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.markDelivered(id, sink, t)
+}
+
+func (c *Cache) markDelivered(id, sink string, t time.Time) *CacheEntry {
+	entry, ok := c.Posts[id]
+	if !ok {
+		entry = &CacheEntry{Seen: t}
+		c.Posts[id] = entry
+	}
+	if entry.Delivered == nil {
+		entry.Delivered = make(map[string]time.Time)
+	}
+	entry.Delivered[sink] = t
+	return entry
+}
+
+// Unmark removes the record of a delivery to the sink, e.g. after a
+// deferred write failed
+func (c *Cache) Unmark(id, sink string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.Posts[id]; ok {
+		delete(entry.Delivered, sink)
+	}
+}
+
+// SetNode records the Dynalist node created for the post by the sink
+func (c *Cache) SetNode(id, sink, nodeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Posts[id]
+	if !ok || nodeID == "" {
+		return
+	}
+	if entry.Nodes == nil {
+		entry.Nodes = make(map[string]string)
+	}
+	entry.Nodes[sink] = nodeID
+}
+
+// Node returns the Dynalist node the sink created for the post, if known
+func (c *Cache) Node(id, sink string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.Posts[id]
+	if !ok {
+		return "", false
+	}
+	nodeID, ok := entry.Nodes[sink]
+	return nodeID, ok
+}
+
+// MarkMerged records that the post was collapsed into the post firstID
+// and needs no delivery to the sink
+func (c *Cache) MarkMerged(id, sink, firstID string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.markDelivered(id, sink, t).MergedInto = firstID
+}
+
+// Describe stores display details for a cached post
+func (c *Cache) Describe(id, title, link, subreddit string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.Posts[id]; ok {
+		entry.Title = title
+		entry.Link = link
+		entry.Subreddit = subreddit
+	}
+}
+
+// CacheSaveTimeout bounds saves that must still happen when the cycle's
+// context was cancelled, e.g. by a shutdown
+const CacheSaveTimeout = 10 * time.Second
+
+// cleanupCheckEvery is how many entries Cleanup visits between checks of
+// its context
+const cleanupCheckEvery = 1000
+
+// SaveToFile saves the cache to a file. Once ctx is done it stops between
+// steps and leaves the previous file in place.
+func (c *Cache) SaveToFile(ctx context.Context, filename string) error {
+	if c.ReadOnly {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.RLock()
+	data, err := c.marshal()
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if c.MaxSize > 0 && int64(len(data)) > c.MaxSize {
+		c.mu.Lock()
+		for int64(len(data)) > c.MaxSize && len(c.Posts) > 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			// Drop a tenth of the entries per round rather than recomputing per entry
+			c.dropOldest(len(c.Posts)/10 + 1)
+			if data, err = c.marshal(); err != nil {
+				break
+			}
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(ctx, filename, data, 0644)
+}
+
+// Len returns the number of cached posts
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.Posts)
+}
+
+// Cleanup removes the entries first seen more than ttl before now and
+// returns how many were removed. Once ctx is done it stops early with the
+// context's error; the remaining entries are left for the next cleanup.
+func (c *Cache) Cleanup(ctx context.Context, ttl time.Duration, now time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed, visited := 0, 0
+	for id, entry := range c.Posts {
+		visited++
+		if visited%cleanupCheckEvery == 0 && ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		if now.Sub(entry.Seen) > ttl {
+			delete(c.Posts, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// DeliveredLinks maps the normalized permalinks of posts delivered to the
+// sink within DedupTTL to their IDs
+func (c *Cache) DeliveredLinks(sink string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	links := make(map[string]string)
+	for id, entry := range c.Posts {
+		if entry.Link != "" && c.deliveredRecently(entry, sink, now) {
+			links[normalizeURL(entry.Link)] = id
+		}
+	}
+	return links
+}
+
+// DeliveredEntries returns copies of the entries delivered to the sink
+func (c *Cache) DeliveredEntries(sink string) []CacheEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var entries []CacheEntry
+	for _, entry := range c.Posts {
+		if _, ok := entry.Delivered[sink]; ok {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+// PrepareCacheFile creates the cache file's directory if needed and checks
+// that files can be written there, so a bad location fails at startup
+// rather than at the first save
+func PrepareCacheFile(filename string) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	probe, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".*.probe")
+	if err != nil {
+		return fmt.Errorf("directory is not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	if f, err := os.OpenFile(filename, os.O_WRONLY, 0); err == nil {
+		f.Close()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file is not writable: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file next to filename and renames
+// it over filename, so a crash mid-write, or ctx being done before the
+// rename, leaves the previous file intact
+func writeFileAtomic(ctx context.Context, filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to chmod temp file: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (c *Cache) marshal() ([]byte, error) {
+	var data []byte
+	var err error
+	if c.Pretty {
+		data, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		data, err = json.Marshal(c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache: %w", err)
+	}
+	return data, nil
+}
+
+// dropOldest removes the n entries seen longest ago
+func (c *Cache) dropOldest(n int) {
+	ids := make([]string, 0, len(c.Posts))
+	for id := range c.Posts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return c.Posts[ids[i]].Seen.Before(c.Posts[ids[j]].Seen) })
+	if n > len(ids) {
+		n = len(ids)
+	}
+	for _, id := range ids[:n] {
+		delete(c.Posts, id)
+	}
+}
+
+// LoadCacheFromFile loads the cache from a file
+func LoadCacheFromFile(filename string) (*Cache, error) {
+	cache := NewCache()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	cache.FirstRuns = nil
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache: %w", err)
+	}
+	if cache.FirstRuns == nil {
+		cache.legacy = true
+		cache.FirstRuns = make(map[string]time.Time)
+	}
+	return cache, nil
+}
+
+// LockCacheFile takes an advisory lock guarding the cache file against
+// concurrent instances. The lock lives in a sidecar "<filename>.lock" file
+// and must be released with UnlockCacheFile.
+func LockCacheFile(filename string, wait bool) (*os.File, error) {
+	return lockFile(filename+".lock", wait)
+}
+
+// UnlockCacheFile releases a lock taken by LockCacheFile
+func UnlockCacheFile(lock *os.File) error {
+	return unlockFile(lock)
+}
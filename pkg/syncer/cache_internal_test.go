@@ -0,0 +1,61 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomicKeepsFileOnPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cache.json")
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", inboxSink, time.Now())
+	if err := cache.SaveToFile(context.Background(), file); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	original, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The process stops after writing half of the new content but before
+	// the rename, like a kill mid-save
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := writeFileAtomic(ctx, file, original[:len(original)/2], 0644); err == nil {
+		t.Fatal("writeFileAtomic succeeded with a cancelled context")
+	}
+	// A temp file left by a crash is ignored too
+	if err := os.WriteFile(filepath.Join(dir, ".cache.json.123.tmp"), original[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(original) {
+		t.Errorf("cache file changed to %s", got)
+	}
+	loaded, err := LoadCacheFromFile(file)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if !loaded.IsDelivered("t3_p1", inboxSink) {
+		t.Error("the preserved cache lost its entry")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("directory holds %d files, want the cache and the crashed temp file only", len(entries))
+	}
+}
@@ -0,0 +1,174 @@
+package syncer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+func TestCacheSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.json")
+	delivered := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cache := syncer.NewCache()
+	cache.MarkDelivered("t3_p1", "dynalist:inbox", delivered)
+	cache.SetNode("t3_p1", "dynalist:inbox", "node1")
+	cache.Describe("t3_p1", "A post", "https://reddit.com/comments/p1/", "golang")
+	if err := cache.SaveToFile(context.Background(), file); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+
+	loaded, err := syncer.LoadCacheFromFile(file)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if !loaded.IsDelivered("t3_p1", "dynalist:inbox") {
+		t.Error("delivery was not kept")
+	}
+	if loaded.IsDelivered("t3_p1", "html") {
+		t.Error("delivery leaked to another sink")
+	}
+	if node, ok := loaded.Node("t3_p1", "dynalist:inbox"); !ok || node != "node1" {
+		t.Errorf("Node() = %q, %v, want node1", node, ok)
+	}
+	entries := loaded.DeliveredEntries("dynalist:inbox")
+	if len(entries) != 1 || entries[0].Title != "A post" || entries[0].Subreddit != "golang" {
+		t.Errorf("DeliveredEntries() = %+v", entries)
+	}
+}
+
+func TestCacheBackfillSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.json")
+	cache := syncer.NewCache()
+	cache.SetBackfill("saved:dynalist:inbox", syncer.BackfillState{After: "t3_p2", Handled: 2})
+	cache.SetBackfill("upvoted:dynalist:inbox", syncer.BackfillState{Handled: 40, Done: true})
+	if err := cache.SaveToFile(context.Background(), file); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+
+	loaded, err := syncer.LoadCacheFromFile(file)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	for key, want := range map[string]syncer.BackfillState{
+		"saved:dynalist:inbox":   {After: "t3_p2", Handled: 2},
+		"upvoted:dynalist:inbox": {Handled: 40, Done: true},
+		"saved:html":             {},
+	} {
+		if got := loaded.BackfillFor(key); got != want {
+			t.Errorf("BackfillFor(%s) = %+v, want %+v", key, got, want)
+		}
+	}
+}
+
+func TestLoadCacheFromMissingFile(t *testing.T) {
+	cache, err := syncer.LoadCacheFromFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if !cache.IsEmpty() {
+		t.Error("cache loaded from a missing file is not empty")
+	}
+}
+
+func TestCacheLocking(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.json")
+	lock, err := syncer.LockCacheFile(file, false)
+	if err != nil {
+		t.Fatalf("LockCacheFile: %v", err)
+	}
+	defer syncer.UnlockCacheFile(lock)
+	if _, err := syncer.LockCacheFile(file, false); err != syncer.ErrLocked {
+		t.Errorf("second LockCacheFile error = %v, want ErrLocked", err)
+	}
+}
+
+// TestCacheConcurrentUse is meant for go test -race
+func TestCacheConcurrentUse(t *testing.T) {
+	cache := syncer.NewCache()
+	file := filepath.Join(t.TempDir(), "cache.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("job%d", i%2)
+			for j := 0; j < 50; j++ {
+				id := fmt.Sprintf("t3_%d_%d", i, j)
+				cache.MarkDelivered(id, key, time.Now())
+				cache.IsDelivered(id, key)
+				state := cache.BackfillFor(key)
+				state.After = id
+				state.Handled++
+				cache.SetBackfill(key, state)
+				cache.SetStarted(key, time.Now())
+				cache.Started(key, key)
+				if j%10 == 0 {
+					if err := cache.SaveToFile(context.Background(), file); err != nil {
+						t.Errorf("SaveToFile: %v", err)
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if cache.Len() != 8*50 {
+		t.Errorf("Len() = %d, want %d", cache.Len(), 8*50)
+	}
+	// BackfillFor hands out copies, so changing one doesn't touch the cache
+	state := cache.BackfillFor("job0")
+	state.Done = true
+	if cache.BackfillFor("job0").Done {
+		t.Error("changing a returned backfill state changed the cache")
+	}
+}
+
+// cancelAfterChecks is a context that reports itself cancelled from its
+// nth Err call on, standing in for a shutdown arriving mid-cleanup
+type cancelAfterChecks struct {
+	context.Context
+	n, checks int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	c.checks++
+	if c.checks >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCacheCleanupCancelled(t *testing.T) {
+	const entries = 50000
+	cache := syncer.NewCache()
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < entries; i++ {
+		cache.MarkDelivered(fmt.Sprintf("t3_%d", i), "test", old)
+	}
+
+	ctx := &cancelAfterChecks{Context: context.Background(), n: 3}
+	removed, err := cache.Cleanup(ctx, 24*time.Hour, time.Now())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Cleanup error = %v, want context.Canceled", err)
+	}
+	if removed == 0 || removed >= entries/2 {
+		t.Errorf("removed %d of %d entries, want an early stop after some progress", removed, entries)
+	}
+	if got := cache.Len(); got != entries-removed {
+		t.Errorf("Len() = %d after removing %d, want %d", got, removed, entries-removed)
+	}
+
+	// The next cleanup removes the rest
+	if _, err := cache.Cleanup(context.Background(), 24*time.Hour, time.Now()); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if got := cache.Len(); got != 0 {
+		t.Errorf("Len() = %d after a full cleanup, want 0", got)
+	}
+}
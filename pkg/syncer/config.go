@@ -0,0 +1,846 @@
+package syncer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// Which link a saved comment's item points at
+const (
+	CommentLinkComment    = "comment"
+	CommentLinkSubmission = "submission"
+)
+
+// Which link a link post's item points at
+const (
+	LinkPostURL       = "url"
+	LinkPostPermalink = "permalink"
+)
+
+// What the first run, with an empty cache, does with existing saved posts
+const (
+	FirstRunImport   = "import"
+	FirstRunSkip     = "skip"
+	FirstRunMarkSeen = "mark-seen"
+)
+
+// defaultFetchLimit is the default number of newest saved items checked
+// each cycle, see FETCH_LIMIT
+const defaultFetchLimit = 25
+
+// Config holds the settings read from environment variables
+type Config struct {
+	ClientID    string
+	Username    string
+	DynalistKey string
+
+	// RefreshToken, when set, is used instead of the token file written by
+	// -authorize
+	RefreshToken string
+	// Accounts are further Reddit accounts synced alongside Username
+	Accounts []RedditAccount
+	// UserAgent replaces the User-Agent generated from the username
+	UserAgent string
+	// Roots of the Reddit API and of its OAuth endpoints, overridable e.g.
+	// to point at a test server
+	RedditAPIBaseURL  string
+	RedditAuthBaseURL string
+
+	// DynalistBaseURL overrides the API root, e.g. to use a proxy
+	DynalistBaseURL string
+	// DynalistHeader is sent with every Dynalist request
+	DynalistHeader http.Header
+	// Basic authentication sent with every Dynalist request
+	DynalistBasicAuthUser     string
+	DynalistBasicAuthPassword string
+	// DynalistRetries is how often a Dynalist request failing with a
+	// network error or 5xx response is retried
+	DynalistRetries int
+	// DynalistMinWriteInterval spaces out Dynalist write requests, 0 sends
+	// them as fast as they come
+	DynalistMinWriteInterval time.Duration
+
+	// CommentLink selects the primary link for saved comments; the other
+	// link, when known, goes into the note
+	CommentLink string
+	// LinkPostLink selects the primary link for link posts, the article or
+	// the permalink; with the article the permalink goes into the note
+	LinkPostLink string
+
+	// CacheFile is where processed posts are remembered
+	CacheFile string
+
+	// StartupDelay postpones the first sync cycle
+	StartupDelay time.Duration
+
+	// CacheLockWait makes a second instance wait for the cache lock
+	// instead of exiting
+	CacheLockWait bool
+
+	// CachePretty writes the cache as indented JSON
+	CachePretty bool
+	// CacheMaxSize bounds the cache file in bytes by dropping the oldest
+	// entries, 0 means unbounded
+	CacheMaxSize int64
+	// CacheTTL is how long entries are kept in the cache file
+	CacheTTL time.Duration
+	// DedupTTL is how long a delivered post counts as already synced,
+	// 0 means for as long as it is cached
+	DedupTTL time.Duration
+
+	// FirstRun decides how saved posts that exist before the first run of
+	// a job are handled, see the FirstRun* constants. FirstRunSkip compares
+	// creation times with the first run on every cycle.
+	FirstRun string
+
+	// PerSubredditLimit caps how many posts of one subreddit are added per
+	// cycle, 0 means unlimited
+	PerSubredditLimit int
+
+	// SoftLimitRetries is how often a 200 response without a listing is
+	// retried before the cycle fails
+	SoftLimitRetries int
+	// RateLimitRetries is how often a 429 response is retried after the
+	// rate limit window resets
+	RateLimitRetries int
+
+	// CatchupBatch caps how many new posts are delivered per cycle so a
+	// backlog is spread over several cycles, 0 means unlimited
+	CatchupBatch int
+
+	// Backfill walks the whole saved listing instead of the newest page,
+	// over as many cycles as it takes, then falls back to the newest page
+	Backfill bool
+
+	// Source is the Reddit listing synced, reddit.ListingSaved unless a job
+	// says otherwise
+	Source string
+	// ImportUpvoted adds a job syncing upvoted posts when SYNC_JOBS is unset
+	ImportUpvoted bool
+	// UnsaveAfterImport removes delivered posts from the saved listing
+	UnsaveAfterImport bool
+
+	// DryRun logs items instead of delivering them; the cache file is only
+	// written with DryRunSaveCache
+	DryRun          bool
+	DryRunSaveCache bool
+
+	// SummaryOutput receives a JSON summary of every cycle, a file path
+	// (appended to) or "-" for stdout; empty disables it
+	SummaryOutput string
+	// WebhookURL receives a Slack/Discord message after cycles that added
+	// posts, empty disables it
+	WebhookURL string
+
+	// HealthPort serves /healthz and /readyz while polling, 0 disables it
+	HealthPort int
+	// TriggerToken enables POST /sync, which must send it as a bearer token
+	TriggerToken string
+	// HealthMaxFailures is how many consecutive failed cycles make /readyz
+	// fail again, 0 means never
+	HealthMaxFailures int
+
+	// LogLevel is the lowest level logged, LogFormat "text" or "json"
+	LogLevel  slog.Level
+	LogFormat string
+
+	// DocumentLookback rebuilds a missing cache from the newest this many
+	// items of the Dynalist document, 0 disables it
+	DocumentLookback int
+	// SeedFromDocument adds the posts linked from the Dynalist document to
+	// the cache on every startup, limited by DocumentLookback when set
+	SeedFromDocument bool
+
+	// AuthVerifyEvery re-checks the Reddit token's account and scopes every
+	// this many cycles, 0 disables the check
+	AuthVerifyEvery int
+
+	// DynalistDocument is the title of the document items are grouped
+	// into and checked against, matched case-insensitively with
+	// DynalistDocumentIgnoreCase. It is only used with GroupBy, see
+	// checkInboxMode.
+	DynalistDocument           string
+	DynalistDocumentIgnoreCase bool
+	// DynalistCreateDocument creates a missing DynalistDocument at the root
+	// when GroupBy needs it
+	DynalistCreateDocument bool
+
+	// GroupBy puts Dynalist items in DynalistDocument under a heading
+	// per day, week or month instead of the inbox, see the group* constants
+	GroupBy string
+	// DateHeadingFormat renders the group heading, see renderHeading.
+	// Empty uses a default for GroupBy.
+	DateHeadingFormat string
+	// Location is the timezone group periods are computed in
+	Location *time.Location
+
+	// PreviewLength is how many characters of a self post's text or a
+	// comment's body items show, 0 leaves them out
+	PreviewLength int
+	// PreviewStripLinks reduces markdown links in the preview to their text
+	PreviewStripLinks bool
+
+	// Format renders item content and notes, built from CONTENT_PRESET and
+	// CONTENT_TEMPLATE
+	Format *ItemFormat
+
+	// MissingPermalink decides how posts without a permalink are linked,
+	// see the reddit.MissingPermalink* constants
+	MissingPermalink string
+
+	// DirectVideoLink points items of Reddit-hosted videos at the video file
+	DirectVideoLink bool
+
+	// ShowStats appends the score and comment count to the note
+	ShowStats bool
+	// CreatedFormat is the Go time layout of the post's creation date
+	// appended to the note, empty leaves it out
+	CreatedFormat string
+
+	// Timeouts of single requests to Reddit and Dynalist
+	RedditHTTPTimeout   time.Duration
+	DynalistHTTPTimeout time.Duration
+	// CycleTimeout limits a whole sync cycle, 0 leaves it to the request
+	// timeouts so long backfills and paced writes can finish
+	CycleTimeout time.Duration
+
+	// ClockSkewMax is the tolerated difference between the local clock and
+	// Reddit's, 0 disables the startup check
+	ClockSkewMax time.Duration
+	// ClockSkewFatal aborts startup instead of warning on excessive skew
+	ClockSkewFatal bool
+
+	// CollapseDuplicates delivers only the first of several posts sharing
+	// a dedup key within one cycle
+	CollapseDuplicates bool
+	// DedupKey selects what identifies duplicates: "url" or "permalink"
+	DedupKey string
+	// DedupPermalink skips posts whose permalink was already delivered
+	// under another fullname
+	DedupPermalink bool
+
+	// StaticMetadata is rendered as tags into every item, to tell apart
+	// the output of several instances writing to the same place
+	StaticMetadata []MetadataPair
+	// StaticMetadataTarget is "content" or "note"
+	StaticMetadataTarget string
+
+	// MaxContentLength limits an item's content in characters, 0 means
+	// unlimited; links and #tags at the end are never cut
+	MaxContentLength int
+	// ContentOverflow decides what happens to the cut text: "note" moves it
+	// into the item note, "truncate" drops it
+	ContentOverflow string
+
+	// InsertPosition places new items before ("prepend") or after
+	// ("append") their siblings, "" keeps the Dynalist inbox setting
+	InsertPosition string
+
+	// OnContentCollision decides what happens when an item's content is
+	// already in the document: "insert", "skip" or "disambiguate"
+	OnContentCollision string
+
+	// Sink selects where new posts go: "dynalist", "html", "markdown",
+	// "nats" or "amqp"
+	Sink string
+	// HTMLFile is the page written by the html sink
+	HTMLFile string
+	// MarkdownFile is appended to by the markdown sink
+	MarkdownFile string
+
+	// TLSConfig holds the custom CA, client certificate and minimum TLS
+	// version of outbound requests, nil keeps Go's defaults
+	TLSConfig *tls.Config
+
+	// PollInterval is the time between sync cycles, the default for jobs
+	PollInterval time.Duration
+	// PollJitter varies each wait between cycles by up to this much either
+	// way, so instances started together drift apart
+	PollJitter time.Duration
+	// FetchLimit is how many of the newest items are checked each cycle,
+	// over as many listing pages as needed
+	FetchLimit int
+	// RunOnce runs a single cycle and exits, like the -once flag
+	RunOnce bool
+
+	// Subreddits restricts syncing to these lowercase subreddit names,
+	// from SUBREDDIT_ALLOW or per job from SYNC_JOBS
+	Subreddits []string
+	// SubredditDeny excludes these lowercase subreddit names, even when
+	// they are allowed
+	SubredditDeny []string
+	// CrosspostUseOriginal matches crossposts against Subreddits by the
+	// subreddit of the original post
+	CrosspostUseOriginal bool
+	// Jobs lists independently scheduled sync jobs, empty means a single
+	// job built from the settings above
+	Jobs []JobSpec
+
+	// Settings of the nats sink
+	NATSURL     string
+	NATSSubject string
+
+	// Settings of the amqp sink
+	AMQPURL        string
+	AMQPExchange   string
+	AMQPRoutingKey string
+}
+
+// RedditAccount is an additional Reddit account to sync
+type RedditAccount struct {
+	Username     string
+	RefreshToken string
+}
+
+// LoadConfig reads and validates the configuration from the environment
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		ClientID:    os.Getenv("REDDIT_CLIENT_ID"),
+		Username:    os.Getenv("REDDIT_USERNAME"),
+		DynalistKey: os.Getenv("DYNALIST_API_KEY"),
+
+		RefreshToken: strings.TrimSpace(os.Getenv("REDDIT_REFRESH_TOKEN")),
+
+		RedditAPIBaseURL:  reddit.DefaultAPIBaseURL,
+		RedditAuthBaseURL: reddit.DefaultAuthBaseURL,
+
+		CommentLink:  CommentLinkComment,
+		LinkPostLink: LinkPostURL,
+		Sink:         SinkDynalist,
+		HTMLFile:     "index.html",
+		MarkdownFile: "reddit-" + markdownDatePlaceholder + ".md",
+
+		NATSURL:        nats.DefaultURL,
+		NATSSubject:    "reddit2dynalist.posts",
+		AMQPRoutingKey: "reddit2dynalist.posts",
+
+		DynalistDocument:       "Reddit",
+		DynalistCreateDocument: true,
+		Source:                 reddit.ListingSaved,
+		CacheFile:              "reddit2dynalist.cache.json",
+
+		CacheTTL:     7 * 24 * time.Hour,
+		PollInterval: defaultInterval,
+		FetchLimit:   defaultFetchLimit,
+
+		SoftLimitRetries:    3,
+		RateLimitRetries:    3,
+		DynalistRetries:     3,
+		FirstRun:            FirstRunImport,
+		ClockSkewMax:        2 * time.Minute,
+		RedditHTTPTimeout:   reddit.DefaultTimeout,
+		DynalistHTTPTimeout: dynalist.DefaultTimeout,
+		DedupKey:            DedupKeyURL,
+		DedupPermalink:      true,
+		MissingPermalink:    reddit.MissingPermalinkConstruct,
+		PreviewLength:       200,
+		HealthPort:          8080,
+		HealthMaxFailures:   3,
+		LogLevel:            slog.LevelInfo,
+		LogFormat:           LogFormatText,
+
+		OnContentCollision: CollisionInsert,
+		ContentOverflow:    OverflowNote,
+
+		StaticMetadataTarget: MetadataInContent,
+
+		Location: time.Local,
+	}
+	if cfg.ClientID == "" || cfg.Username == "" {
+		return nil, fmt.Errorf("missing required environment variables, please set REDDIT_CLIENT_ID and REDDIT_USERNAME")
+	}
+
+	env := &envReader{}
+	env.str("DYNALIST_BASE_URL", &cfg.DynalistBaseURL)
+	env.header("DYNALIST_HEADER", &cfg.DynalistHeader)
+	env.basicAuth("DYNALIST_BASIC_AUTH", &cfg.DynalistBasicAuthUser, &cfg.DynalistBasicAuthPassword)
+	env.integer("DYNALIST_RETRIES", &cfg.DynalistRetries, 0)
+	env.duration("DYNALIST_MIN_WRITE_INTERVAL", &cfg.DynalistMinWriteInterval)
+	env.choice("COMMENT_LINK", &cfg.CommentLink, CommentLinkComment, CommentLinkSubmission)
+	env.choice("LINK_POST_LINK", &cfg.LinkPostLink, LinkPostURL, LinkPostPermalink)
+	env.str("CACHE_FILE", &cfg.CacheFile)
+	env.duration("STARTUP_DELAY", &cfg.StartupDelay)
+
+	cacheLock := "fail"
+	env.choice("CACHE_LOCK", &cacheLock, "fail", "wait")
+	cfg.CacheLockWait = cacheLock == "wait"
+	env.boolean("CACHE_PRETTY", &cfg.CachePretty)
+	env.size("CACHE_MAX_SIZE", &cfg.CacheMaxSize)
+	env.duration("CACHE_TTL", &cfg.CacheTTL)
+	env.duration("DEDUP_TTL", &cfg.DedupTTL)
+
+	env.choice("FIRST_RUN", &cfg.FirstRun, FirstRunImport, FirstRunSkip, FirstRunMarkSeen)
+	env.integer("PER_SUBREDDIT_LIMIT", &cfg.PerSubredditLimit, 0)
+	env.integer("SOFT_LIMIT_RETRIES", &cfg.SoftLimitRetries, 0)
+	env.integer("RATE_LIMIT_RETRIES", &cfg.RateLimitRetries, 0)
+	env.integer("CATCHUP_BATCH", &cfg.CatchupBatch, 0)
+	env.integer("AUTH_VERIFY_EVERY", &cfg.AuthVerifyEvery, 0)
+	env.boolean("BACKFILL", &cfg.Backfill)
+	env.boolean("IMPORT_UPVOTED", &cfg.ImportUpvoted)
+	env.boolean("UNSAVE_AFTER_IMPORT", &cfg.UnsaveAfterImport)
+	env.boolean("DRY_RUN", &cfg.DryRun)
+	env.boolean("DRY_RUN_SAVE_CACHE", &cfg.DryRunSaveCache)
+	env.boolean("RUN_ONCE", &cfg.RunOnce)
+	if v, ok := env.lookup("POLL_INTERVAL"); ok {
+		d, err := parseInterval(v)
+		if err != nil {
+			env.fail("POLL_INTERVAL", v, err)
+		}
+		cfg.PollInterval = d
+	}
+	env.duration("POLL_JITTER", &cfg.PollJitter)
+	env.integer("FETCH_LIMIT", &cfg.FetchLimit, 1)
+	if v, ok := env.lookup("FETCH_LIMIT"); ok && cfg.FetchLimit > reddit.ListingCap {
+		env.fail("FETCH_LIMIT", v, fmt.Errorf("must be at most %d, the most Reddit lists", reddit.ListingCap))
+	}
+	env.integer("DOCUMENT_LOOKBACK", &cfg.DocumentLookback, 0)
+	env.boolean("SEED_FROM_DOCUMENT", &cfg.SeedFromDocument)
+	env.str("SUMMARY_OUTPUT", &cfg.SummaryOutput)
+	env.str("WEBHOOK_URL", &cfg.WebhookURL)
+	env.logLevel("LOG_LEVEL", &cfg.LogLevel)
+	env.choice("LOG_FORMAT", &cfg.LogFormat, LogFormatText, LogFormatJSON)
+	env.integer("HEALTH_PORT", &cfg.HealthPort, 0)
+	env.str("TRIGGER_TOKEN", &cfg.TriggerToken)
+	env.integer("HEALTH_MAX_FAILURES", &cfg.HealthMaxFailures, 0)
+	env.boolean("CROSSPOST_USE_ORIGINAL", &cfg.CrosspostUseOriginal)
+	env.subreddits("SUBREDDIT_ALLOW", &cfg.Subreddits)
+	env.subreddits("SUBREDDIT_DENY", &cfg.SubredditDeny)
+	env.boolean("DIRECT_VIDEO_LINK", &cfg.DirectVideoLink)
+	env.boolean("SHOW_STATS", &cfg.ShowStats)
+	env.str("CREATED_FORMAT", &cfg.CreatedFormat)
+	env.choice("MISSING_PERMALINK", &cfg.MissingPermalink, reddit.MissingPermalinkConstruct, reddit.MissingPermalinkURL, reddit.MissingPermalinkSkip)
+	env.integer("PREVIEW_LENGTH", &cfg.PreviewLength, 0)
+	env.boolean("PREVIEW_STRIP_LINKS", &cfg.PreviewStripLinks)
+	preset, compact := PresetDefault, false
+	env.boolean("COMPACT", &compact)
+	if compact {
+		preset = PresetCompact
+	}
+	var contentTemplate string
+	env.str("CONTENT_PRESET", &preset)
+	env.str("CONTENT_TEMPLATE", &contentTemplate)
+	if env.err == nil {
+		format, err := NewItemFormat(strings.ToLower(preset), contentTemplate)
+		if err != nil && contentTemplate != "" {
+			// A broken template shouldn't stop the sync, the preset still works
+			slog.Warn("Invalid CONTENT_TEMPLATE, using the preset's content", "preset", preset, "error", err)
+			format, err = NewItemFormat(strings.ToLower(preset), "")
+		}
+		if err != nil {
+			env.err = fmt.Errorf("invalid content format: %w", err)
+		}
+		cfg.Format = format
+	}
+	env.str("DYNALIST_DOCUMENT", &cfg.DynalistDocument)
+	env.boolean("DYNALIST_DOCUMENT_IGNORE_CASE", &cfg.DynalistDocumentIgnoreCase)
+	env.boolean("DYNALIST_CREATE_DOCUMENT", &cfg.DynalistCreateDocument)
+	env.str("DATE_HEADING_FORMAT", &cfg.DateHeadingFormat)
+	env.choice("GROUP_BY", &cfg.GroupBy, GroupNone, GroupDay, GroupWeek, GroupMonth)
+	env.location("TIMEZONE", &cfg.Location)
+	if cfg.GroupBy == "" {
+		// A heading format on its own groups by day, as before GROUP_BY
+		cfg.GroupBy = GroupNone
+		if cfg.DateHeadingFormat != "" {
+			cfg.GroupBy = GroupDay
+		}
+	}
+
+	env.duration("CLOCK_SKEW_MAX", &cfg.ClockSkewMax)
+	env.positiveDuration("REDDIT_HTTP_TIMEOUT", &cfg.RedditHTTPTimeout)
+	env.positiveDuration("DYNALIST_HTTP_TIMEOUT", &cfg.DynalistHTTPTimeout)
+	env.duration("CYCLE_TIMEOUT", &cfg.CycleTimeout)
+	env.boolean("CLOCK_SKEW_FATAL", &cfg.ClockSkewFatal)
+
+	env.boolean("COLLAPSE_DUPLICATES", &cfg.CollapseDuplicates)
+	env.choice("DEDUP_KEY", &cfg.DedupKey, DedupKeyURL, DedupKeyPermalink)
+	env.boolean("DEDUP_PERMALINK", &cfg.DedupPermalink)
+
+	env.metadata("STATIC_METADATA", &cfg.StaticMetadata)
+	env.choice("STATIC_METADATA_TARGET", &cfg.StaticMetadataTarget, MetadataInContent, MetadataInNote)
+	env.integer("MAX_CONTENT_LENGTH", &cfg.MaxContentLength, 0)
+	env.choice("CONTENT_OVERFLOW", &cfg.ContentOverflow, OverflowNote, OverflowTruncate)
+	env.choice("INSERT_POSITION", &cfg.InsertPosition, dynalist.InsertPrepend, dynalist.InsertAppend)
+	env.choice("ON_CONTENT_COLLISION", &cfg.OnContentCollision, CollisionInsert, CollisionSkip, CollisionDisambiguate)
+
+	env.choice("SINK", &cfg.Sink, SinkDynalist, SinkHTML, SinkMarkdown, SinkNATS, SinkAMQP)
+	env.str("HTML_FILE", &cfg.HTMLFile)
+	env.str("MARKDOWN_FILE", &cfg.MarkdownFile)
+	env.str("NATS_URL", &cfg.NATSURL)
+	env.str("NATS_SUBJECT", &cfg.NATSSubject)
+	env.str("AMQP_URL", &cfg.AMQPURL)
+	env.str("AMQP_EXCHANGE", &cfg.AMQPExchange)
+	env.str("AMQP_ROUTING_KEY", &cfg.AMQPRoutingKey)
+
+	var caFile, certFile, keyFile, minTLS string
+	env.str("TLS_CA_FILE", &caFile)
+	env.str("TLS_CERT_FILE", &certFile)
+	env.str("TLS_KEY_FILE", &keyFile)
+	env.str("TLS_MIN_VERSION", &minTLS)
+	if env.err == nil {
+		cfg.TLSConfig, env.err = loadTLSConfig(caFile, certFile, keyFile, minTLS)
+	}
+
+	env.accounts(cfg.Username, &cfg.Accounts)
+	env.str("REDDIT_USER_AGENT", &cfg.UserAgent)
+	env.str("REDDIT_API_BASE_URL", &cfg.RedditAPIBaseURL)
+	env.str("REDDIT_AUTH_BASE_URL", &cfg.RedditAuthBaseURL)
+	cfg.RedditAPIBaseURL = strings.TrimRight(cfg.RedditAPIBaseURL, "/")
+	cfg.RedditAuthBaseURL = strings.TrimRight(cfg.RedditAuthBaseURL, "/")
+
+	if v, ok := env.lookup("SYNC_JOBS"); ok {
+		jobs, err := parseJobSpecs(v)
+		if err != nil {
+			env.err = fmt.Errorf("invalid SYNC_JOBS: %w", err)
+		}
+		cfg.Jobs = jobs
+	}
+
+	if env.err != nil {
+		return nil, env.err
+	}
+	sinks := map[string]bool{cfg.Sink: len(cfg.Jobs) == 0}
+	for _, job := range cfg.Jobs {
+		if job.Sink == "" {
+			sinks[cfg.Sink] = true
+		} else {
+			sinks[strings.ToLower(job.Sink)] = true
+		}
+	}
+	if cfg.DynalistKey == "" && sinks[SinkDynalist] {
+		return nil, fmt.Errorf("missing required environment variable DYNALIST_API_KEY")
+	}
+	if cfg.AMQPURL == "" && sinks[SinkAMQP] {
+		return nil, fmt.Errorf("missing required environment variable AMQP_URL")
+	}
+	if sinks[SinkDynalist] && cfg.GroupBy == GroupNone {
+		if err := checkInboxMode(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// checkInboxMode rejects settings that read DynalistDocument while items go
+// to the inbox. The inbox can be any document and the API doesn't say
+// which, so comparing against DynalistDocument would miss every item.
+func checkInboxMode(cfg *Config) error {
+	var names []string
+	if cfg.OnContentCollision != CollisionInsert {
+		names = append(names, "ON_CONTENT_COLLISION="+cfg.OnContentCollision)
+	}
+	if cfg.DocumentLookback > 0 {
+		names = append(names, "DOCUMENT_LOOKBACK")
+	}
+	if cfg.SeedFromDocument {
+		names = append(names, "SEED_FROM_DOCUMENT")
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s read DYNALIST_DOCUMENT, but items go to the Dynalist inbox; "+
+		"set GROUP_BY to add them to DYNALIST_DOCUMENT", strings.Join(names, " and "))
+}
+
+// envReader parses typed environment variables into config fields. Unset
+// variables leave the field at its default; the first invalid value is
+// kept in err and later calls become no-ops.
+type envReader struct {
+	err error
+}
+
+func (e *envReader) lookup(name string) (string, bool) {
+	if e.err != nil {
+		return "", false
+	}
+	v := strings.TrimSpace(os.Getenv(name))
+	return v, v != ""
+}
+
+func (e *envReader) fail(name, value string, err error) {
+	e.err = fmt.Errorf("invalid %s %q: %w", name, value, err)
+}
+
+// accounts reads REDDIT_USERNAME_2 and REDDIT_REFRESH_TOKEN_2, _3 and so on
+// until the first unset number. Each account needs its own refresh token.
+func (e *envReader) accounts(primary string, dst *[]RedditAccount) {
+	seen := map[string]bool{strings.ToLower(primary): true}
+	for n := 2; ; n++ {
+		name := fmt.Sprintf("REDDIT_USERNAME_%d", n)
+		username, ok := e.lookup(name)
+		if !ok {
+			return
+		}
+		if seen[strings.ToLower(username)] {
+			e.fail(name, username, fmt.Errorf("account is already configured"))
+			return
+		}
+		seen[strings.ToLower(username)] = true
+		token, ok := e.lookup(fmt.Sprintf("REDDIT_REFRESH_TOKEN_%d", n))
+		if !ok {
+			if e.err == nil {
+				e.err = fmt.Errorf("missing REDDIT_REFRESH_TOKEN_%d for %s %q", n, name, username)
+			}
+			return
+		}
+		*dst = append(*dst, RedditAccount{Username: username, RefreshToken: token})
+	}
+}
+
+func (e *envReader) str(name string, dst *string) {
+	if v, ok := e.lookup(name); ok {
+		*dst = v
+	}
+}
+
+// header accepts a single "Name: value" header
+func (e *envReader) header(name string, dst *http.Header) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	key, value, found := strings.Cut(v, ":")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		e.fail(name, v, fmt.Errorf("expected \"Name: value\""))
+		return
+	}
+	*dst = http.Header{}
+	dst.Add(key, strings.TrimSpace(value))
+}
+
+// basicAuth accepts "user:password"
+func (e *envReader) basicAuth(name string, user, password *string) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	u, p, found := strings.Cut(v, ":")
+	if !found || u == "" {
+		// Don't echo the value, it contains a password
+		e.err = fmt.Errorf("invalid %s: expected \"user:password\"", name)
+		return
+	}
+	*user, *password = u, p
+}
+
+// subreddits accepts a comma-separated list of subreddit names, with or
+// without the "r/" prefix
+func (e *envReader) subreddits(name string, dst *[]string) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	*dst = normalizeSubreddits(strings.Split(v, ","))
+}
+
+// normalizeSubreddits lowercases names and strips "r/" prefixes and blanks
+func normalizeSubreddits(names []string) []string {
+	var out []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "r/"))
+		if name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// metadata accepts comma-separated key=value pairs; the value may be empty
+func (e *envReader) metadata(name string, dst *[]MetadataPair) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	var pairs []MetadataPair
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			e.fail(name, v, fmt.Errorf("expected key=value pairs separated by commas"))
+			return
+		}
+		pairs = append(pairs, MetadataPair{Key: key, Value: strings.TrimSpace(value)})
+	}
+	*dst = pairs
+}
+
+// choice accepts one of the given values, compared case-insensitively
+func (e *envReader) choice(name string, dst *string, choices ...string) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	v = strings.ToLower(v)
+	for _, c := range choices {
+		if v == c {
+			*dst = v
+			return
+		}
+	}
+	e.fail(name, v, fmt.Errorf("expected one of %s", strings.Join(choices, ", ")))
+}
+
+func (e *envReader) logLevel(name string, dst *slog.Level) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	level, err := parseLogLevel(v)
+	if err != nil {
+		e.fail(name, v, err)
+		return
+	}
+	*dst = level
+}
+
+// location accepts an IANA timezone name such as "Europe/Berlin"
+func (e *envReader) location(name string, dst **time.Location) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		e.fail(name, v, err)
+		return
+	}
+	*dst = loc
+}
+
+func (e *envReader) boolean(name string, dst *bool) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(name, v, fmt.Errorf("expected true or false"))
+		return
+	}
+	*dst = b
+}
+
+// integer accepts whole numbers not below min
+func (e *envReader) integer(name string, dst *int, min int) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(name, v, fmt.Errorf("expected a whole number"))
+		return
+	}
+	if n < min {
+		e.fail(name, v, fmt.Errorf("must be at least %d", min))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) positiveDuration(name string, dst *time.Duration) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := parseDuration(v)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	if err != nil {
+		e.fail(name, v, err)
+		return
+	}
+	*dst = d
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		e.fail(name, v, err)
+		return
+	}
+	*dst = d
+}
+
+func (e *envReader) size(name string, dst *int64) {
+	v, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := parseSize(v)
+	if err != nil {
+		e.fail(name, v, err)
+		return
+	}
+	*dst = n
+}
+
+// parseDuration is time.ParseDuration that rejects bare numbers other than
+// 0, since "5" could mean seconds or minutes, and negative durations
+func parseDuration(v string) (time.Duration, error) {
+	if _, err := strconv.ParseFloat(v, 64); err == nil && v != "0" {
+		return 0, fmt.Errorf("missing unit, use e.g. %ss or %sm", v, v)
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration like 90s, 5m or 1h30m")
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return d, nil
+}
+
+// sizeUnits are the accepted size suffixes, longest first so "KB" wins over "B"
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses a byte size such as "512KB" or "10MB". Units are binary
+// (1KB = 1024 bytes) and a bare number means bytes.
+func parseSize(v string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(v))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix))
+			mult = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a size like 512KB or 10MB")
+	}
+	return n * mult, nil
+}
@@ -0,0 +1,144 @@
+package syncer
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestLoadConfigInboxMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"collision", map[string]string{"ON_CONTENT_COLLISION": CollisionSkip}, "ON_CONTENT_COLLISION=skip"},
+		{"lookback", map[string]string{"DOCUMENT_LOOKBACK": "50"}, "DOCUMENT_LOOKBACK"},
+		{"seed", map[string]string{"SEED_FROM_DOCUMENT": "true"}, "SEED_FROM_DOCUMENT"},
+		{"grouped", map[string]string{"GROUP_BY": GroupDay, "SEED_FROM_DOCUMENT": "true", "ON_CONTENT_COLLISION": CollisionSkip}, ""},
+		{"other sink", map[string]string{"SINK": SinkHTML, "SEED_FROM_DOCUMENT": "true"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := LoadConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig error = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigProxySettings(t *testing.T) {
+	for name, value := range map[string]string{
+		"DYNALIST_HEADER":     "no colon",
+		"DYNALIST_BASIC_AUTH": ":password",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			t.Setenv(name, value)
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("%s=%q was accepted", name, value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHTTPTimeouts(t *testing.T) {
+	cfg := testConfig(t, nil)
+	if cfg.RedditHTTPTimeout != reddit.DefaultTimeout || cfg.DynalistHTTPTimeout != dynalist.DefaultTimeout {
+		t.Errorf("default timeouts = %v, %v, want %v, %v", cfg.RedditHTTPTimeout, cfg.DynalistHTTPTimeout,
+			reddit.DefaultTimeout, dynalist.DefaultTimeout)
+	}
+
+	cfg = testConfig(t, map[string]string{"REDDIT_HTTP_TIMEOUT": "45s", "DYNALIST_HTTP_TIMEOUT": "1m30s"})
+	if cfg.RedditHTTPTimeout != 45*time.Second || cfg.DynalistHTTPTimeout != 90*time.Second {
+		t.Errorf("timeouts = %v, %v, want 45s, 1m30s", cfg.RedditHTTPTimeout, cfg.DynalistHTTPTimeout)
+	}
+	if got := NewDynalistClient(cfg).HTTPClient.Timeout; got != 90*time.Second {
+		t.Errorf("Dynalist client timeout = %v, want 1m30s", got)
+	}
+	redditClient, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, cfg.RedditHTTPTimeout)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if got := redditClient.HTTPClient.Timeout; got != 45*time.Second {
+		t.Errorf("Reddit client timeout = %v, want 45s", got)
+	}
+
+	for _, value := range []string{"0", "-5s", "30", "soon"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			t.Setenv("DYNALIST_HTTP_TIMEOUT", value)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "DYNALIST_HTTP_TIMEOUT") {
+				t.Errorf("LoadConfig error = %v, want DYNALIST_HTTP_TIMEOUT=%s rejected", err, value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFetchLimitBounds(t *testing.T) {
+	if cfg := testConfig(t, nil); cfg.FetchLimit != defaultFetchLimit {
+		t.Errorf("FetchLimit = %d without FETCH_LIMIT, want %d", cfg.FetchLimit, defaultFetchLimit)
+	}
+	for _, value := range []string{"0", "1001", "many"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			t.Setenv("FETCH_LIMIT", value)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "FETCH_LIMIT") {
+				t.Errorf("LoadConfig error = %v, want FETCH_LIMIT=%s rejected", err, value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAccounts(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		ok   bool
+	}{
+		{"same as primary", map[string]string{"REDDIT_USERNAME_2": "Alice", "REDDIT_REFRESH_TOKEN_2": "t"}, false},
+		{"missing token", map[string]string{"REDDIT_USERNAME_2": "bob"}, false},
+		{"gap ends the list", map[string]string{"REDDIT_USERNAME_3": "carol", "REDDIT_REFRESH_TOKEN_3": "t"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDDIT_CLIENT_ID", "test-client")
+			t.Setenv("REDDIT_USERNAME", "alice")
+			t.Setenv("DYNALIST_API_KEY", "test-token")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := LoadConfig()
+			if (err == nil) != tt.ok {
+				t.Fatalf("LoadConfig error = %v, want ok %v", err, tt.ok)
+			}
+			if err == nil && len(cfg.Accounts) != 0 {
+				t.Errorf("Accounts = %+v, want none after a gap", cfg.Accounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Supported values of the CONTENT_OVERFLOW setting
+const (
+	OverflowNote     = "note"
+	OverflowTruncate = "truncate"
+)
+
+// Where STATIC_METADATA tags are rendered
+const (
+	MetadataInContent = "content"
+	MetadataInNote    = "note"
+)
+
+// MetadataPair is one key/value of STATIC_METADATA
+type MetadataPair struct {
+	Key   string
+	Value string
+}
+
+// metadataTags renders pairs as Dynalist tags, e.g. "#inst_home #acct_main".
+// Characters that would end a tag are replaced with "_".
+func metadataTags(pairs []MetadataPair) string {
+	tags := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		tag := p.Key
+		if p.Value != "" {
+			tag += "_" + p.Value
+		}
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+				return r
+			}
+			return '_'
+		}, tag)
+		tags = append(tags, "#"+tag)
+	}
+	return strings.Join(tags, " ")
+}
+
+// truncationMarker replaces the cut part of an over-long content
+const truncationMarker = "…"
+
+// fitContent shortens content to at most max characters (runes, so
+// multi-byte text is never split). Trailing links and #tags are kept
+// intact and the text before them is cut. In OverflowNote mode the cut text
+// is moved to the start of the note, otherwise it is dropped. ok is false
+// when content already fit.
+func fitContent(content, note string, max int, mode string) (newContent, newNote string, ok bool) {
+	if max <= 0 || len([]rune(content)) <= max {
+		return content, note, false
+	}
+	body, tail := splitProtected(content)
+	room := max - len([]rune(tail)) - len([]rune(truncationMarker))
+	if room < 0 {
+		// The protected tail alone is too long, cut from the end as a last resort
+		body, tail = content, ""
+		room = max - len([]rune(truncationMarker))
+	}
+	runes := []rune(body)
+	kept := strings.TrimRightFunc(string(runes[:room]), unicode.IsSpace)
+	cut := strings.TrimSpace(string(runes[room:]))
+
+	newContent = kept + truncationMarker + tail
+	newNote = note
+	if mode == OverflowNote && cut != "" {
+		newNote = truncationMarker + cut
+		if note != "" {
+			newNote += "\n" + note
+		}
+	}
+	return newContent, newNote, true
+}
+
+// markdownLink renders a Dynalist link, escaping brackets in text that would
+// end it early
+func markdownLink(text, url string) string {
+	text = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(text)
+	return "[" + text + "](" + url + ")"
+}
+
+// textPreview collapses the whitespace of a post or comment text and cuts
+// it to max characters at a word boundary, see truncateAtWord. It returns ""
+// when there is no text or max is 0.
+func textPreview(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if max <= 0 || text == "" {
+		return ""
+	}
+	return truncateAtWord(text, max)
+}
+
+// truncateAtWord cuts s to at most max characters (runes), marking the cut
+// with truncationMarker. The cut falls between words unless the first word
+// alone is too long.
+func truncateAtWord(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	room := max - len([]rune(truncationMarker))
+	if room < 0 {
+		room = 0
+	}
+	if !unicode.IsSpace(runes[room]) {
+		// Back up to the start of the word that doesn't fit
+		if i := strings.LastIndexFunc(string(runes[:room]), unicode.IsSpace); i >= 0 {
+			runes = []rune(string(runes[:room])[:i])
+			room = len(runes)
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:room]), unicode.IsSpace) + truncationMarker
+}
+
+// markdownLinkPattern matches "[text](url)" in Reddit markdown
+var markdownLinkPattern = regexp.MustCompile(`\[([^\]]*)\]\([^)\s]*\)`)
+
+// stripMarkdownLinks replaces markdown links with their text
+func stripMarkdownLinks(s string) string {
+	return markdownLinkPattern.ReplaceAllString(s, "$1")
+}
+
+// splitProtected splits off the trailing links and #tags of content, along
+// with the separator before them. Of a trailing markdown link only the
+// "](url)" part is protected, so its text can still be shortened.
+func splitProtected(content string) (body, tail string) {
+	end := len(content)
+	cut := end
+	for {
+		trimmed := strings.TrimRightFunc(content[:cut], unicode.IsSpace)
+		i := strings.LastIndexFunc(trimmed, unicode.IsSpace) + 1
+		word := trimmed[i:]
+		if j := strings.LastIndex(word, "](http"); j >= 0 && strings.HasSuffix(word, ")") {
+			cut = i + j
+			break
+		}
+		if word == "" || !(strings.HasPrefix(word, "http://") || strings.HasPrefix(word, "https://") || strings.HasPrefix(word, "#")) {
+			break
+		}
+		cut = i
+	}
+	if cut == end {
+		return content, ""
+	}
+	body = content[:cut]
+	// Keep a " - " style separator with the tail
+	trimmed := strings.TrimRight(body, " -–|:")
+	return trimmed, content[len(trimmed):]
+}
@@ -0,0 +1,52 @@
+package syncer
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateAtWord(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"shorter", "hello world", 20, "hello world"},
+		{"exact fit", "hello world", 11, "hello world"},
+		{"mid-word", "hello world", 8, "hello…"},
+		{"cut at a space", "hello world", 6, "hello…"},
+		{"single long word", "supercalifragilistic", 6, "super…"},
+		{"multibyte mid-word", "привет мир", 8, "привет…"},
+		{"multibyte without spaces", "日本語のテキスト", 5, "日本語の…"},
+		{"multibyte exact fit", "日本語", 3, "日本語"},
+	}
+	for _, tt := range tests {
+		got := truncateAtWord(tt.s, tt.max)
+		if got != tt.want {
+			t.Errorf("%s: truncateAtWord(%q, %d) = %q, want %q", tt.name, tt.s, tt.max, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > tt.max || !utf8.ValidString(got) {
+			t.Errorf("%s: result %q has %d runes or is invalid UTF-8, max %d", tt.name, got, n, tt.max)
+		}
+	}
+}
+
+func TestTextPreview(t *testing.T) {
+	if got := textPreview("  a\n\nsaved   comment ", 100); got != "a saved comment" {
+		t.Errorf("textPreview() = %q, want the whitespace collapsed", got)
+	}
+	if got := textPreview("a saved comment", 0); got != "" {
+		t.Errorf("textPreview() with PREVIEW_LENGTH 0 = %q, want none", got)
+	}
+	if got := textPreview("a saved comment", 9); got != "a saved…" {
+		t.Errorf("textPreview() = %q, want it cut at a word", got)
+	}
+}
+
+func TestStripMarkdownLinks(t *testing.T) {
+	got := stripMarkdownLinks("See [the docs](https://go.dev/doc) and [this](/r/golang), not [x] (y).")
+	if want := "See the docs and this, not [x] (y)."; got != want {
+		t.Errorf("stripMarkdownLinks() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,452 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// listingKey is where the first run and backfill cursor of a job are
+// cached. Listings other than saved share the sink, but not its cursor.
+func listingKey(cfg *Config, sink Sink) string {
+	if cfg.Source != reddit.ListingSaved {
+		return sink.Name() + "#" + cfg.Source
+	}
+	return sink.Name()
+}
+
+// FirstRunPending reports whether no cycle of job has fetched its listing
+// completely yet, see FIRST_RUN
+func (job *SyncJob) FirstRunPending(cache *Cache) bool {
+	_, started := cache.Started(listingKey(job.Cfg, job.Sink), job.Sink.Name())
+	return !started
+}
+
+// FetchErrors counts the cycles whose listing fetch failed, across all jobs
+var FetchErrors atomic.Int64
+
+// RunCycle runs one sync cycle of a job: it fetches the listing cfg names
+// through redditClient, delivers the posts not yet in cache to sink and
+// saves the cache to cacheFile
+func RunCycle(
+	ctx context.Context,
+	redditClient *reddit.Client,
+	cfg *Config,
+	sink Sink,
+	cache *Cache,
+	cacheFile string,
+) Summary {
+	if cfg.CycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.CycleTimeout)
+		defer cancel()
+	}
+
+	var summary Summary
+	key := listingKey(cfg, sink)
+	filter := newPostFilter(cfg, cache, sink)
+	if !filter.started {
+		switch cfg.FirstRun {
+		case FirstRunMarkSeen:
+			slog.Info("First run: marking current saved posts as seen without delivering them", "sink", sink.Name())
+		case FirstRunSkip:
+			slog.Info("First run: only posts created from now on will be delivered", "sink", sink.Name())
+		}
+	}
+	if starter, ok := sink.(CycleStarter); ok {
+		if err := starter.Start(ctx, cache, sink.Name()); err != nil {
+			slog.Error("Failed to prepare sink", "sink", sink.Name(), "error", err)
+			summary.Err = err
+			return summary
+		}
+	}
+	// Filter on the streaming goroutine against a snapshot of the cache, so
+	// only new posts are ever held in memory, page by page. The check is
+	// repeated below against the live cache.
+	delivered := cache.DeliveredIDs(sink.Name())
+	filtered := 0 // only read once the stream is drained
+	isNew := func(post reddit.Post) bool {
+		if delivered[post.FullID] {
+			return false
+		}
+		if !shouldProcess(post, cfg) {
+			filtered++
+			return false
+		}
+		return true
+	}
+	// A backfill walks the whole listing over as many cycles as it takes,
+	// resuming after the last post it handled
+	var backfill *BackfillState
+	start, max := "", cfg.FetchLimit
+	if cfg.Backfill {
+		if state := cache.BackfillFor(key); !state.Done {
+			backfill = &state
+			start, max = state.After, 0
+			if start != "" {
+				slog.Info("Resuming backfill", "after", start, "handled", state.Handled)
+			}
+		}
+	}
+	posts, errs := redditClient.StreamListing(ctx, cfg.Username, cfg.Source, reddit.PageSize, max, start, isNew)
+
+	// held stops the backfill cursor at the first post left for a later
+	// cycle, so it isn't skipped when resuming
+	held := false
+	previous := ""
+	advanceBackfill := func() {
+		if backfill != nil && !held && previous != "" {
+			backfill.After = previous
+			backfill.Handled++
+			cache.SetBackfill(key, *backfill)
+		}
+	}
+	// queued holds the backfill state before each post handed to the sink,
+	// to rewind the cursor to if a batching sink then fails to write it
+	type queuedPost struct {
+		id     string
+		before BackfillState
+	}
+	var queued []queuedPost
+	finish := func() {
+		finisher, ok := sink.(CycleFinisher)
+		if !ok {
+			return
+		}
+		err := finisher.Finish(ctx, cache, sink.Name())
+		if err != nil {
+			slog.Error("Failed to finish sink", "sink", sink.Name(), "error", err)
+			summary.Err = err
+			// Finish unmarks the posts it failed to write; resume the
+			// backfill before the first of them
+			held = true
+			for _, q := range queued {
+				if !cache.IsDelivered(q.id, sink.Name()) {
+					*backfill = q.before
+					cache.SetBackfill(key, *backfill)
+					break
+				}
+			}
+		}
+		queued = queued[:0]
+	}
+
+	newPosts := 0
+	var added []string // for UNSAVE_AFTER_IMPORT
+	for post := range posts {
+		advanceBackfill()
+		previous = post.FullID
+		if summary.Fetched > 0 && summary.Fetched%reddit.PageSize == 0 {
+			// A page worth of posts has been handled, persist progress; the
+			// save at the end of the cycle covers a cancelled one. Batched
+			// items are written first, so only written posts are saved
+			// as delivered.
+			finish()
+			if err := cache.SaveToFile(ctx, cacheFile); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to save cache", "file", cacheFile, "error", err)
+			}
+			if backfill != nil {
+				slog.Info("Backfill in progress", "sink", sink.Name(), "handled", backfill.Handled, "after", backfill.After)
+			}
+		}
+		summary.Fetched++
+		action, first := filter.decide(&post)
+		switch action {
+		case actionCached, actionFiltered:
+			// Filtered posts were already counted while streaming
+			continue
+		case actionNoPermalink:
+			// Cached so the warning isn't repeated every cycle
+			cache.MarkDelivered(post.FullID, sink.Name(), time.Now())
+			summary.Skipped++
+			continue
+		case actionMarkSeen:
+			cache.MarkDelivered(post.FullID, sink.Name(), time.Now())
+			summary.MarkedSeen++
+			continue
+		case actionTooOld:
+			continue
+		case actionSameLink:
+			slog.Info("Skipping post, its permalink was already delivered", "post_id", post.FullID, "as", first)
+			cache.MarkMerged(post.FullID, sink.Name(), first, time.Now())
+			summary.Merged++
+			continue
+		case actionDuplicate:
+			slog.Info("Collapsing duplicate post", "post_id", post.FullID, "into", first, "key", dedupKey(post, cfg.DedupKey))
+			cache.MarkMerged(post.FullID, sink.Name(), first, time.Now())
+			summary.Merged++
+			continue
+		case actionBacklog:
+			summary.Backlog++
+			held = true
+			continue
+		case actionDeferred:
+			summary.Deferred++
+			held = true
+			continue
+		}
+		content, note := buildItem(post, cfg)
+		slog.Info("Adding new saved post", "sink", sink.Name(), "post_id", post.FullID, "subreddit", post.Subreddit, "note", note)
+		err := sink.Add(ctx, Item{Post: post, Content: content, Note: note})
+		if err != nil && !errors.Is(err, errContentCollision) {
+			// Left uncached so the next cycle retries it
+			slog.Error("Failed to deliver item", "sink", sink.Name(), "post_id", post.FullID, "error", err)
+			summary.Failed++
+			held = true
+			continue
+		}
+		// Batching sinks unmark the post again if their Finish fails
+		cache.MarkDelivered(post.FullID, sink.Name(), time.Now())
+		cache.Describe(post.FullID, postTitle(post), post.PermalinkURL(), post.Subreddit)
+		if err != nil {
+			slog.Info("Skipping post, the document already has an item with the same content", "post_id", post.FullID)
+			summary.Skipped++
+			continue
+		}
+		newPosts++
+		added = append(added, post.FullID)
+		if backfill != nil {
+			queued = append(queued, queuedPost{id: post.FullID, before: *backfill})
+		}
+		filter.delivered(post)
+	}
+	advanceBackfill()
+	err := <-errs
+	summary.Filtered = filtered
+	if err != nil {
+		slog.Error("Failed to fetch saved posts", "error", err)
+		FetchErrors.Add(1)
+		summary.Err = err
+	} else if !filter.started {
+		// Only a complete fetch ends the first run, so a failed one is
+		// repeated with the same FIRST_RUN handling
+		cache.SetStarted(key, filter.since)
+	}
+	// Written before the backfill is recorded complete, so posts a batching
+	// sink fails to write are fetched again
+	finish()
+	if err == nil && backfill != nil && !held {
+		if start != "" && summary.Fetched == 0 {
+			// Reddit returns nothing after a post that is no longer saved
+			slog.Info("Backfill cursor returned no posts, restarting from the newest", "after", start)
+			backfill.After = ""
+		} else {
+			slog.Info("Backfill complete", "handled", backfill.Handled)
+			backfill.After = ""
+			backfill.Done = true
+		}
+		cache.SetBackfill(key, *backfill)
+	}
+
+	if _, err := cache.Cleanup(ctx, cfg.CacheTTL, time.Now()); err != nil {
+		slog.Warn("Cache cleanup interrupted, continuing next cycle", "error", err)
+	}
+
+	if cfg.UnsaveAfterImport && cfg.Source == reddit.ListingSaved && !cfg.DryRun {
+		unsaveDelivered(ctx, redditClient, cache, sink.Name(), added)
+	}
+
+	if summary.MarkedSeen > 0 {
+		slog.Info("Marked existing saved posts as seen", "posts", summary.MarkedSeen)
+	}
+	if summary.Backlog > 0 {
+		slog.Info("Catching up", "handled", filter.attempted, "waiting", summary.Backlog)
+	}
+	if summary.Deferred > 0 {
+		slog.Info("Deferred posts to later cycles because of PER_SUBREDDIT_LIMIT", "posts", summary.Deferred)
+	}
+	if newPosts > 0 {
+		if cfg.DryRun {
+			slog.Info("Dry run: would have added new posts", "account", cfg.Username, "sink", sink.Name(), "posts", newPosts)
+		} else {
+			slog.Info("Added new posts", "account", cfg.Username, "sink", sink.Name(), "posts", newPosts)
+		}
+	} else {
+		slog.Info("No new posts found", "account", cfg.Username, "sink", sink.Name())
+	}
+
+	// Saved even when the cycle was cancelled, so its progress isn't lost
+	saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), CacheSaveTimeout)
+	defer cancelSave()
+	if err := cache.SaveToFile(saveCtx, cacheFile); err != nil {
+		slog.Warn("Failed to save cache", "file", cacheFile, "error", err)
+	}
+
+	summary.Added = newPosts
+	return summary
+}
+
+// RunBackfill runs a cycle of job and, while a backfill is in progress,
+// further cycles until it completes, a cycle fails or one makes no progress.
+// Without BACKFILL it runs a single cycle.
+func RunBackfill(ctx context.Context, job *SyncJob, cache *Cache, run func(*SyncJob) Summary) Summary {
+	var summary Summary
+	for {
+		handled := 0
+		if job.Cfg.Backfill {
+			handled = cache.BackfillFor(listingKey(job.Cfg, job.Sink)).Handled
+		}
+		s := run(job)
+		summary.Add(s)
+		if !job.Cfg.Backfill || s.Err != nil || s.Failed > 0 || ctx.Err() != nil {
+			return summary
+		}
+		state := cache.BackfillFor(listingKey(job.Cfg, job.Sink))
+		if state.Done || state.Handled == handled {
+			return summary
+		}
+		slog.Info("Backfill not finished, running another cycle", "job", job.Name, "handled", state.Handled)
+	}
+}
+
+// unsaveDelivered removes the delivered posts from the saved listing. Posts
+// a batching sink failed to write in Finish are no longer marked delivered
+// and are kept. A failure is only logged: the post was delivered and stays
+// cached, so it is not delivered again.
+func unsaveDelivered(ctx context.Context, redditClient *reddit.Client, cache *Cache, sink string, ids []string) {
+	for _, id := range ids {
+		if !cache.IsDelivered(id, sink) {
+			continue
+		}
+		if err := redditClient.Unsave(ctx, id); err != nil {
+			slog.Warn("Failed to unsave post", "post_id", id, "error", err)
+		}
+	}
+}
+
+// Actions postFilter.decide takes on a post
+type postAction int
+
+const (
+	actionDeliver     postAction = iota
+	actionCached                 // already delivered to the sink
+	actionFiltered               // excluded by SUBREDDITS or SUBREDDIT_DENY
+	actionNoPermalink            // cached undelivered, see MISSING_PERMALINK
+	actionMarkSeen               // cached undelivered, FIRST_RUN=mark_seen
+	actionTooOld                 // created before the first run, FIRST_RUN=skip
+	actionSameLink               // merged, DEDUP_PERMALINK
+	actionDuplicate              // merged, COLLAPSE_DUPLICATES
+	actionBacklog                // left for a later cycle, CATCHUP_BATCH
+	actionDeferred               // left for a later cycle, PER_SUBREDDIT_LIMIT
+)
+
+// postFilter decides what a cycle of a job does with each post, keeping the
+// state that builds up over the cycle, such as the posts per subreddit. It
+// does not change the cache, so plans use it too.
+type postFilter struct {
+	cfg   *Config
+	cache *Cache
+	sink  string
+	// since is when the first run started, now if it is pending
+	since   time.Time
+	started bool
+
+	links        map[string]string // normalized permalink -> delivered fullname
+	firstByKey   map[string]string // dedup key -> fullname
+	perSubreddit map[string]int
+	attempted    int
+}
+
+func newPostFilter(cfg *Config, cache *Cache, sink Sink) *postFilter {
+	since, started := cache.Started(listingKey(cfg, sink), sink.Name())
+	if !started {
+		since = time.Now()
+	}
+	return &postFilter{
+		cfg:          cfg,
+		cache:        cache,
+		sink:         sink.Name(),
+		since:        since,
+		started:      started,
+		links:        cache.DeliveredLinks(sink.Name()),
+		firstByKey:   make(map[string]string),
+		perSubreddit: make(map[string]int),
+	}
+}
+
+// decide returns the action to take on post, resolving its permalink. For
+// the merging actions it also returns the fullname the post is merged into.
+// Deliveries count towards CATCHUP_BATCH and PER_SUBREDDIT_LIMIT.
+func (f *postFilter) decide(post *reddit.Post) (postAction, string) {
+	cfg := f.cfg
+	if f.cache.IsDelivered(post.FullID, f.sink) {
+		return actionCached, ""
+	}
+	if !shouldProcess(*post, cfg) {
+		return actionFiltered, ""
+	}
+	if !post.ResolvePermalink(cfg.MissingPermalink) {
+		return actionNoPermalink, ""
+	}
+	if !f.started && cfg.FirstRun == FirstRunMarkSeen {
+		return actionMarkSeen, ""
+	}
+	if cfg.FirstRun == FirstRunSkip && post.CreatedTime().Before(f.since) {
+		// A creation time filter on every cycle, so posts saved
+		// later that were created before the first run are skipped too
+		return actionTooOld, ""
+	}
+	if first, ok := f.links[normalizeURL(post.PermalinkURL())]; ok && cfg.DedupPermalink {
+		// The same item under another fullname, e.g. after re-saving
+		return actionSameLink, first
+	}
+	if cfg.CatchupBatch > 0 && f.attempted >= cfg.CatchupBatch {
+		// Left uncached, later cycles work through the backlog
+		return actionBacklog, ""
+	}
+	dedup := dedupKey(*post, cfg.DedupKey)
+	if first, ok := f.firstByKey[dedup]; ok && cfg.CollapseDuplicates {
+		return actionDuplicate, first
+	}
+	if cfg.PerSubredditLimit > 0 {
+		sub := strings.ToLower(post.Subreddit)
+		if f.perSubreddit[sub] >= cfg.PerSubredditLimit {
+			// Left uncached so a later cycle picks it up
+			return actionDeferred, ""
+		}
+		f.perSubreddit[sub]++
+	}
+	f.firstByKey[dedup] = post.FullID
+	f.attempted++
+	return actionDeliver, ""
+}
+
+// delivered records that post was delivered, for DEDUP_PERMALINK
+func (f *postFilter) delivered(post reddit.Post) {
+	f.links[normalizeURL(post.PermalinkURL())] = post.FullID
+}
+
+// shouldProcess applies the subreddit allow and deny lists of cfg to a
+// post. With both set, the deny list wins.
+func shouldProcess(post reddit.Post, cfg *Config) bool {
+	if len(cfg.SubredditDeny) > 0 && subredditAllowed(post, cfg.SubredditDeny, cfg.CrosspostUseOriginal) {
+		return false
+	}
+	return subredditAllowed(post, cfg.Subreddits, cfg.CrosspostUseOriginal)
+}
+
+// subredditAllowed reports whether the post's subreddit is in allowed,
+// which holds lowercase names; an empty list allows everything. With
+// useOrigin, crossposts are judged by the subreddit they were crossposted
+// from instead of the one they were crossposted to.
+func subredditAllowed(post reddit.Post, allowed []string, useOrigin bool) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	sub := post.Subreddit
+	if useOrigin {
+		sub = post.OriginSubreddit()
+	}
+	sub = strings.ToLower(sub)
+	for _, a := range allowed {
+		if a == sub {
+			return true
+		}
+	}
+	return false
+}
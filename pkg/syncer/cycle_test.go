@@ -0,0 +1,545 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/internal/cassette"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestRunCycleCassettes(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"DYNALIST_API_KEY":    cassette.Redacted,
+		"DYNALIST_BASE_URL":   cassette.Replay(t, "testdata/cycle_dynalist.json").URL,
+		"GROUP_BY":            GroupDay,
+		"DATE_HEADING_FORMAT": "Saved",
+	})
+	sink, err := NewSink(cfg)
+	if err != nil {
+		t.Fatalf("NewSink: %v", err)
+	}
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+
+	summary := RunCycle(context.Background(), newCassetteReddit(t, "cycle_reddit.json"), cfg, sink, cache, cacheFile)
+	if summary.Err != nil {
+		t.Fatalf("RunCycle: %v", summary.Err)
+	}
+	if summary.Fetched != 2 || summary.Added != 2 {
+		t.Errorf("summary = %+v, want 2 fetched and added", summary)
+	}
+	for id, node := range map[string]string{"t3_1akz9q3": "Fd6JpQ1sRw8Ym3Ct5Gv0NbXe", "t1_kq9zx2a": "Ua9KcT2hLx7Pz4Eq1Wr6MnSo"} {
+		if got, ok := cache.Node(id, inboxSink); !ok || got != node {
+			t.Errorf("Node(%s) = %q, want %q", id, got, node)
+		}
+	}
+
+	saved, err := LoadCacheFromFile(cacheFile)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if !saved.IsDelivered("t1_kq9zx2a", inboxSink) {
+		t.Error("the saved cache misses the delivered comment")
+	}
+	if h, ok := saved.HeadingFor(inboxSink); !ok || h.NodeID != "Hq2WmX9vTc4Lr7Bp0Ns5KyDa" {
+		t.Errorf("heading = %+v, %v", h, ok)
+	}
+}
+
+// recordingSink records the IDs of the posts it is given
+type recordingSink struct {
+	name  string
+	added []string
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Add(ctx context.Context, item Item) error {
+	s.added = append(s.added, item.Post.FullID)
+	return nil
+}
+
+// listingOf returns a listing of posts created at the given times, keyed
+// by ID
+func listingOf(posts map[string]time.Time) string {
+	var children []string
+	for id, created := range posts {
+		children = append(children, fmt.Sprintf(`{"kind":"t3","data":{"id":%q,"title":"Post","subreddit":"golang","permalink":"/r/golang/comments/%s/post/","created_utc":%d}}`, id, id, created.Unix()))
+	}
+	sort.Strings(children)
+	return `{"kind":"Listing","data":{"after":null,"children":[` + strings.Join(children, ",") + `]}}`
+}
+
+// serveListing answers every listing request with the current value of
+// *listing
+func serveListing(t *testing.T, listing *string) *reddit.Client {
+	return newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, *listing)
+	})
+}
+
+func TestRunCycleFirstRunMarkSeen(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"FIRST_RUN": FirstRunMarkSeen})
+	old := time.Now().Add(-time.Hour)
+	listing := listingOf(map[string]time.Time{"p1": old, "p2": old})
+	redditClient := serveListing(t, &listing)
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &recordingSink{name: "test"}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Err != nil || summary.MarkedSeen != 2 || len(sink.added) != 0 {
+		t.Fatalf("first cycle: summary = %+v, added %v", summary, sink.added)
+	}
+
+	listing = listingOf(map[string]time.Time{"p1": old, "p2": old, "p3": old})
+	summary = RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.MarkedSeen != 0 || fmt.Sprint(sink.added) != "[t3_p3]" {
+		t.Errorf("second cycle: summary = %+v, added %v, want t3_p3", summary, sink.added)
+	}
+}
+
+func TestRunCycleFirstRunSkipFiltersByCreation(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"FIRST_RUN": FirstRunSkip})
+	old, recent := time.Now().Add(-24*time.Hour), time.Now().Add(time.Hour)
+	listing := listingOf(map[string]time.Time{"p1": old, "p2": recent})
+	redditClient := serveListing(t, &listing)
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &recordingSink{name: "test"}
+
+	RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if fmt.Sprint(sink.added) != "[t3_p2]" {
+		t.Fatalf("first cycle added %v, want t3_p2", sink.added)
+	}
+
+	// An old post saved after the first run is still skipped
+	listing = listingOf(map[string]time.Time{"p1": old, "p2": recent, "p3": old})
+	RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if fmt.Sprint(sink.added) != "[t3_p2]" {
+		t.Errorf("second cycle added %v, want nothing new", sink.added)
+	}
+
+	// The start of the first run survives a restart
+	loaded, err := LoadCacheFromFile(cacheFile)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	job := &SyncJob{Cfg: cfg, Sink: sink}
+	if job.FirstRunPending(loaded) {
+		t.Error("the first run is pending again after reloading the cache")
+	}
+}
+
+func TestRunCycleFirstRunPerJob(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"FIRST_RUN": FirstRunMarkSeen})
+	old := time.Now().Add(-time.Hour)
+	listing := listingOf(map[string]time.Time{"p1": old})
+	redditClient := serveListing(t, &listing)
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	saved := &recordingSink{name: "test"}
+	RunCycle(context.Background(), redditClient, cfg, saved, cache, cacheFile)
+
+	// The upvoted listing of the same sink and another sink have their own
+	// first run, instead of delivering everything because the cache is no
+	// longer empty
+	upvoted := *cfg
+	upvoted.Source = reddit.ListingUpvoted
+	other := &recordingSink{name: "other"}
+	listing = listingOf(map[string]time.Time{"p1": old, "p2": old})
+	for _, run := range []struct {
+		cfg  *Config
+		sink *recordingSink
+	}{{&upvoted, saved}, {cfg, other}} {
+		summary := RunCycle(context.Background(), redditClient, run.cfg, run.sink, cache, cacheFile)
+		if len(run.sink.added) != 0 || summary.MarkedSeen == 0 {
+			t.Errorf("%s %s: summary = %+v, added %v, want posts marked seen", run.cfg.Source, run.sink.name, summary, run.sink.added)
+		}
+	}
+}
+
+func TestRunCycleFailedFetchKeepsFirstRun(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"FIRST_RUN": FirstRunMarkSeen})
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	cache := NewCache()
+	job := &SyncJob{Cfg: cfg, Sink: &recordingSink{name: "test"}}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, job.Sink, cache, filepath.Join(t.TempDir(), "cache.json"))
+	if summary.Err == nil {
+		t.Fatal("RunCycle succeeded against a failing listing")
+	}
+	if !job.FirstRunPending(cache) {
+		t.Error("a failed fetch ended the first run")
+	}
+}
+
+func TestCacheStartedLegacy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.json")
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	data := `{"Posts":{"t3_p1":{"seen":"2024-05-02T00:00:00Z","delivered":{"test":"2024-05-02T00:00:00Z"}}},"Since":"2024-05-01T00:00:00Z"}`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := LoadCacheFromFile(file)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if got, ok := cache.Started("test", "test"); !ok || !got.Equal(since) {
+		t.Errorf("Started(test) = %v, %v, want %v", got, ok, since)
+	}
+	if _, ok := cache.Started("other", "other"); ok {
+		t.Error("a sink without deliveries counts as started")
+	}
+}
+
+func TestRunCycleBackfillResumes(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BACKFILL": "true"})
+	interrupted := true
+	var afters []string
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		after := r.URL.Query().Get("after")
+		afters = append(afters, after)
+		switch {
+		case after == "":
+			io.WriteString(w, `{"kind":"Listing","data":{"after":"t3_p2","children":[
+				{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}},
+				{"kind":"t3","data":{"id":"p2","title":"Two","subreddit":"golang","permalink":"/r/golang/comments/p2/two/"}}]}}`)
+		case interrupted:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[
+				{"kind":"t3","data":{"id":"p3","title":"Three","subreddit":"golang","permalink":"/r/golang/comments/p3/three/"}}]}}`)
+		}
+	})
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &recordingSink{name: "test"}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, NewCache(), cacheFile)
+	if summary.Err == nil {
+		t.Fatal("the interrupted cycle succeeded")
+	}
+
+	// A restart picks up the cursor from the cache file
+	cache, err := LoadCacheFromFile(cacheFile)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if state := cache.BackfillFor(listingKey(cfg, sink)); state.After != "t3_p2" || state.Handled != 2 || state.Done {
+		t.Fatalf("saved backfill = %+v, want after t3_p2", state)
+	}
+	interrupted = false
+	afters = nil
+	summary = RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Err != nil {
+		t.Fatalf("RunCycle: %v", summary.Err)
+	}
+	if fmt.Sprint(afters) != "[t3_p2]" {
+		t.Errorf("resumed with after = %q, want only t3_p2", afters)
+	}
+	if fmt.Sprint(sink.added) != "[t3_p1 t3_p2 t3_p3]" {
+		t.Errorf("added %v, want every post once", sink.added)
+	}
+	if state := cache.BackfillFor(listingKey(cfg, sink)); state.After != "" || !state.Done {
+		t.Errorf("backfill = %+v, want it done with the cursor cleared", state)
+	}
+}
+
+// batchingSink queues items like a grouped InboxSink and writes them in
+// Finish, which fails for the posts in fail
+type batchingSink struct {
+	recordingSink
+	queued  []string
+	fail    map[string]bool
+	batches []int
+}
+
+func (s *batchingSink) Add(ctx context.Context, item Item) error {
+	s.queued = append(s.queued, item.Post.FullID)
+	return nil
+}
+
+func (s *batchingSink) Finish(ctx context.Context, cache *Cache, name string) error {
+	queued := s.queued
+	s.queued = nil
+	s.batches = append(s.batches, len(queued))
+	var err error
+	for _, id := range queued {
+		if s.fail[id] {
+			cache.Unmark(id, name)
+			err = errors.New("edit failed")
+			continue
+		}
+		s.added = append(s.added, id)
+	}
+	return err
+}
+
+func TestRunCycleBackfillFinishFailure(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BACKFILL": "true"})
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		children := `{"kind":"t3","data":{"id":"p2","title":"Two","subreddit":"golang","permalink":"/r/golang/comments/p2/two/"}},
+			{"kind":"t3","data":{"id":"p3","title":"Three","subreddit":"golang","permalink":"/r/golang/comments/p3/three/"}}`
+		if r.URL.Query().Get("after") == "" {
+			children = `{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}},` + children
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":null,"children":[`+children+`]}}`)
+	})
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &batchingSink{recordingSink: recordingSink{name: "test"}, fail: map[string]bool{"t3_p2": true, "t3_p3": true}}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Err == nil {
+		t.Error("the failed Finish is not reported")
+	}
+	if state := cache.BackfillFor(listingKey(cfg, sink)); state.After != "t3_p1" || state.Handled != 1 || state.Done {
+		t.Fatalf("backfill = %+v, want it resuming after t3_p1", state)
+	}
+
+	sink.fail = nil
+	summary = RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Err != nil {
+		t.Fatalf("RunCycle: %v", summary.Err)
+	}
+	if fmt.Sprint(sink.added) != "[t3_p1 t3_p2 t3_p3]" {
+		t.Errorf("added %v, want the unwritten posts retried", sink.added)
+	}
+	if state := cache.BackfillFor(listingKey(cfg, sink)); !state.Done {
+		t.Errorf("backfill = %+v, want it done", state)
+	}
+}
+
+func TestRunCycleFinishesEachPage(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BACKFILL": "true"})
+	posts := make(map[string]time.Time)
+	for i := 0; i < reddit.PageSize+50; i++ {
+		posts[fmt.Sprintf("p%03d", i)] = time.Now()
+	}
+	listing := listingOf(posts)
+	redditClient := serveListing(t, &listing)
+	sink := &batchingSink{recordingSink: recordingSink{name: "test"}}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, NewCache(), filepath.Join(t.TempDir(), "cache.json"))
+	if summary.Err != nil {
+		t.Fatalf("RunCycle: %v", summary.Err)
+	}
+	// Written before the cache is saved after the first page
+	if fmt.Sprint(sink.batches) != fmt.Sprint([]int{reddit.PageSize, 50}) {
+		t.Errorf("batches = %v, want one per page", sink.batches)
+	}
+}
+
+func TestRunCycleBackfillCursorUse(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		state    BackfillState
+		wantFrom string
+	}{
+		{"incremental polling", nil, BackfillState{After: "t3_p2", Handled: 2}, ""},
+		{"backfill in progress", map[string]string{"BACKFILL": "true"}, BackfillState{After: "t3_p2", Handled: 2}, "t3_p2"},
+		{"backfill done", map[string]string{"BACKFILL": "true"}, BackfillState{Handled: 3, Done: true}, ""},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, tt.env)
+		var afters []string
+		redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+			afters = append(afters, r.URL.Query().Get("after"))
+			io.WriteString(w, listingOf(map[string]time.Time{"p3": time.Now()}))
+		})
+		sink := &recordingSink{name: "test"}
+		cache := NewCache()
+		cache.SetBackfill(listingKey(cfg, sink), tt.state)
+
+		RunCycle(context.Background(), redditClient, cfg, sink, cache, filepath.Join(t.TempDir(), "cache.json"))
+		if len(afters) == 0 || afters[0] != tt.wantFrom {
+			t.Errorf("%s: listing requested after %q, want %q", tt.name, afters, tt.wantFrom)
+		}
+		if tt.env == nil && cache.BackfillFor(listingKey(cfg, sink)) != tt.state {
+			t.Errorf("%s: incremental cycle changed the backfill to %+v", tt.name, cache.BackfillFor(listingKey(cfg, sink)))
+		}
+	}
+}
+
+func TestRunCycleTimeout(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"CYCLE_TIMEOUT": "50ms"})
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	start := time.Now()
+	summary := RunCycle(context.Background(), redditClient, cfg, &recordingSink{name: "test"}, NewCache(), filepath.Join(t.TempDir(), "cache.json"))
+	if summary.Err == nil {
+		t.Fatal("RunCycle succeeded past CYCLE_TIMEOUT")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the cycle took %s, CYCLE_TIMEOUT was not applied", elapsed)
+	}
+}
+
+func TestShouldProcess(t *testing.T) {
+	tests := []struct {
+		allow, deny string
+		subreddit   string
+		want        bool
+	}{
+		{"", "", "golang", true},
+		{"golang, r/Rust", "", "GoLang", true},
+		{"golang,rust", "", "python", false},
+		{"", "pics", "Pics", false},
+		{"", "pics", "golang", true},
+		{"golang,pics", "PICS", "pics", false},
+		{"golang,pics", "pics", "golang", true},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, map[string]string{"SUBREDDIT_ALLOW": tt.allow, "SUBREDDIT_DENY": tt.deny})
+		post := reddit.Post{Subreddit: tt.subreddit}
+		if got := shouldProcess(post, cfg); got != tt.want {
+			t.Errorf("shouldProcess(r/%s) with allow %q and deny %q = %v, want %v", tt.subreddit, tt.allow, tt.deny, got, tt.want)
+		}
+	}
+}
+
+func TestRunCycleSavesCacheWhenCancelled(t *testing.T) {
+	cfg := testConfig(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("after") != "" {
+			// Shutdown is requested while the second page is fetched
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, `{"kind":"Listing","data":{"after":"t3_p1","children":[
+			{"kind":"t3","data":{"id":"p1","title":"One","subreddit":"golang","permalink":"/r/golang/comments/p1/one/"}}]}}`)
+	})
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+
+	summary := RunCycle(ctx, redditClient, cfg, &recordingSink{name: "test"}, NewCache(), cacheFile)
+	if !errors.Is(summary.Err, context.Canceled) {
+		t.Errorf("RunCycle error = %v, want it cancelled", summary.Err)
+	}
+	saved, err := LoadCacheFromFile(cacheFile)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	if !saved.IsDelivered("t3_p1", "test") {
+		t.Error("the post delivered before the shutdown is missing from the saved cache")
+	}
+}
+
+// failingSink fails to deliver the posts in fail
+type failingSink struct {
+	recordingSink
+	fail map[string]bool
+}
+
+func (s *failingSink) Add(ctx context.Context, item Item) error {
+	if s.fail[item.Post.FullID] {
+		return errors.New("write failed")
+	}
+	return s.recordingSink.Add(ctx, item)
+}
+
+func TestRunCycleFailedAddStaysUncached(t *testing.T) {
+	cfg := testConfig(t, nil)
+	listing := listingOf(map[string]time.Time{"p1": time.Now(), "p2": time.Now()})
+	redditClient := serveListing(t, &listing)
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &failingSink{recordingSink: recordingSink{name: "test"}, fail: map[string]bool{"t3_p1": true}}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Failed != 1 || summary.Added != 1 {
+		t.Errorf("summary = %+v, want one failed and one added", summary)
+	}
+	if cache.IsDelivered("t3_p1", "test") {
+		t.Error("the post that failed to write is cached")
+	}
+	if !cache.IsDelivered("t3_p2", "test") {
+		t.Error("the written post is not cached")
+	}
+
+	// The next cycle tries it again
+	sink.fail = nil
+	RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if fmt.Sprint(sink.added) != "[t3_p2 t3_p1]" {
+		t.Errorf("added %v, want t3_p1 retried", sink.added)
+	}
+}
+
+func TestRunCycleUnsavesOnlyDelivered(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"UNSAVE_AFTER_IMPORT": "true"})
+	listing := listingOf(map[string]time.Time{"p1": time.Now(), "p2": time.Now()})
+	var unsaved []string
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/unsave" {
+			io.WriteString(w, listing)
+			return
+		}
+		unsaved = append(unsaved, r.FormValue("id"))
+		// A failed unsave must not undo the delivery
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	cache := NewCache()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	sink := &failingSink{recordingSink: recordingSink{name: "test"}, fail: map[string]bool{"t3_p1": true}}
+
+	summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+	if summary.Err != nil || summary.Added != 1 {
+		t.Errorf("summary = %+v, want one added", summary)
+	}
+	if fmt.Sprint(unsaved) != "[t3_p2]" {
+		t.Errorf("unsaved %v, want only the delivered t3_p2", unsaved)
+	}
+	if !cache.IsDelivered("t3_p2", "test") {
+		t.Error("the delivered post was uncached after its unsave failed")
+	}
+}
+
+func TestRunCycleFetchLimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  string // limit of each page requested
+	}{
+		{"10", "[10]"},
+		{"150", "[100 50]"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, map[string]string{"FETCH_LIMIT": tt.limit})
+		// A full first page, continued by a second one
+		first := make(map[string]time.Time)
+		for i := 0; i < 100; i++ {
+			first[fmt.Sprintf("a%02d", i)] = time.Now()
+		}
+		page := strings.Replace(listingOf(first), `"after":null`, `"after":"t3_a99"`, 1)
+		var limits []string
+		redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+			limits = append(limits, r.URL.Query().Get("limit"))
+			if r.URL.Query().Get("after") == "" {
+				io.WriteString(w, page)
+			} else {
+				io.WriteString(w, listingOf(map[string]time.Time{"b1": time.Now()}))
+			}
+		})
+		sink := &recordingSink{name: "test"}
+
+		RunCycle(context.Background(), redditClient, cfg, sink, NewCache(), filepath.Join(t.TempDir(), "cache.json"))
+		if fmt.Sprint(limits) != tt.want {
+			t.Errorf("FETCH_LIMIT=%s: requested limits %v, want %s", tt.limit, limits, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package syncer
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// Supported values of the DEDUP_KEY setting
+const (
+	DedupKeyURL       = "url"
+	DedupKeyPermalink = "permalink"
+)
+
+// dedupKey returns the key identifying duplicates of a post. For "url" the
+// linked URL is used, falling back to the permalink for self posts and
+// comments.
+func dedupKey(post reddit.Post, key string) string {
+	if key == DedupKeyURL && post.URL != "" && !post.IsComment {
+		return normalizeURL(post.URL)
+	}
+	return normalizeURL(post.PermalinkURL())
+}
+
+// normalizeURL lowercases scheme and host, drops a leading "www." and
+// trailing slashes so trivially different spellings compare equal
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(raw, "/")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,52 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://reddit.com/r/golang/comments/p1/a_post/", "https://reddit.com/r/golang/comments/p1/a_post"},
+		{"HTTPS://WWW.Reddit.COM/r/golang/comments/p1/a_post", "https://reddit.com/r/golang/comments/p1/a_post"},
+		{" https://reddit.com/r/golang/comments/p1/a_post/#comments ", "https://reddit.com/r/golang/comments/p1/a_post"},
+		{"https://example.com/Article?id=1", "https://example.com/Article?id=1"},
+		{"/r/golang/comments/p1/", "/r/golang/comments/p1"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURL(tt.in); got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRunCyclePermalinkDedup(t *testing.T) {
+	post := func(id, permalink string) string {
+		return fmt.Sprintf(`{"kind":"t3","data":{"id":%q,"title":"Post","subreddit":"golang","permalink":%q}}`, id, permalink)
+	}
+	var listing string
+	redditClient := serveListing(t, &listing)
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+
+	for _, enabled := range []bool{true, false} {
+		cfg := testConfig(t, map[string]string{"DEDUP_PERMALINK": fmt.Sprint(enabled)})
+		cache := NewCache()
+		sink := &recordingSink{name: "test"}
+		listing = `{"kind":"Listing","data":{"after":null,"children":[` + post("p1", "/r/golang/comments/p1/post/") + `]}}`
+		RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+
+		// Re-saved under another fullname, the permalink spelled differently
+		listing = `{"kind":"Listing","data":{"after":null,"children":[` + post("p9", "/r/golang/comments/p1/post") + `]}}`
+		summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, cacheFile)
+		if enabled && (fmt.Sprint(sink.added) != "[t3_p1]" || summary.Merged != 1) {
+			t.Errorf("DEDUP_PERMALINK=true: added %v, summary %+v, want the re-saved post skipped", sink.added, summary)
+		}
+		if !enabled && fmt.Sprint(sink.added) != "[t3_p1 t3_p9]" {
+			t.Errorf("DEDUP_PERMALINK=false: added %v, want both delivered", sink.added)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package syncer
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockFile opens path without locking, flock is not available on this platform
+func lockFile(path string, wait bool) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	return f, nil
+}
+
+// unlockFile releases a file opened by lockFile
+func unlockFile(f *os.File) error {
+	return f.Close()
+}
@@ -0,0 +1,150 @@
+package syncer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Names of the built-in CONTENT_PRESET formats
+const (
+	PresetDefault  = "default"
+	PresetCompact  = "compact"
+	PresetDetailed = "detailed"
+	PresetObsidian = "obsidian"
+	PresetTags     = "tags"
+	PresetTitle    = "title"
+)
+
+// contentPreset is a pair of templates rendering an item's content and note
+type contentPreset struct {
+	Content string
+	Note    string
+}
+
+// contentPresets are the built-in formats selectable with CONTENT_PRESET
+var contentPresets = map[string]contentPreset{
+	PresetDefault: {
+		Content: `{{with .Subreddit}}[r/{{.}}] {{end}}Post by {{.Author}}{{with .Preview}}: {{.}}{{end}} - {{.MediaLink}}`,
+		Note:    `{{.Title}} - {{.Link}}{{with .SecondaryLink}}` + "\n" + `{{.}}{{end}}`,
+	},
+	PresetCompact: {
+		Content: `{{mdlink .Title .Link}}`,
+	},
+	PresetDetailed: {
+		Content: `{{.Title}} - {{.MediaLink}}`,
+		Note: `r/{{.Subreddit}} · u/{{.Author}} · {{.Created.Format "2006-01-02 15:04"}} UTC` + "\n" +
+			`{{.Link}}{{with .SecondaryLink}}` + "\n" + `{{.}}{{end}}`,
+	},
+	PresetObsidian: {
+		Content: `{{mdlink .Title .MediaLink}}`,
+		Note: `source:: {{.Link}}` + "\n" + `subreddit:: {{.Subreddit}}` + "\n" +
+			`author:: {{.Author}}` + "\n" + `created:: {{.Created.Format "2006-01-02"}}`,
+	},
+	PresetTags: {
+		Content: `{{.Title}} - {{.MediaLink}} {{tag .Subreddit}} {{tag .Kind}}`,
+		Note:    `{{.Link}}{{with .SecondaryLink}}` + "\n" + `{{.}}{{end}}`,
+	},
+	PresetTitle: {
+		Content: `{{.Title}}`,
+		Note:    `{{.MediaLink}}{{if ne .MediaLink .Link}}` + "\n" + `{{.Link}}{{end}}{{with .SecondaryLink}}` + "\n" + `{{.}}{{end}}`,
+	},
+}
+
+// presetNames returns the names of the built-in presets, sorted
+func presetNames() []string {
+	names := make([]string, 0, len(contentPresets))
+	for name := range contentPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// itemData is what content and note templates are executed with
+type itemData struct {
+	Kind          string // "post" or "comment"
+	IsComment     bool
+	Title         string // post title, or "Comment by ..." / "Post by ..." without one
+	Author        string
+	Subreddit     string
+	Link          string // permalink, the submission per COMMENT_LINK or the article per LINK_POST_LINK
+	SecondaryLink string // the other link of a comment or link post, if known
+	MediaLink     string // Link, or the video file with DIRECT_VIDEO_LINK
+	Permalink     string // the post or comment on Reddit, whatever Link is
+	URL           string // the URL a link post points to
+	Preview       string // start of the self text or comment body, see PREVIEW_LENGTH
+	Created       time.Time
+	Source        string // listing the post came from, "saved" or "upvoted"
+	Score         int
+	NumComments   int    // 0 for comments
+	Stats         string // e.g. "↑1234, 56 comments", see postStats
+}
+
+// CreatedTime is Created, named like reddit.Post.CreatedTime
+func (d itemData) CreatedTime() time.Time { return d.Created }
+
+// templateFuncs are available to content and note templates
+var templateFuncs = template.FuncMap{
+	"mdlink": markdownLink,
+	"tag": func(s string) string {
+		return metadataTags([]MetadataPair{{Key: s}})
+	},
+}
+
+// ItemFormat renders items from a pair of templates
+type ItemFormat struct {
+	content *template.Template
+	note    *template.Template
+}
+
+// NewItemFormat parses the named preset, with contentTemplate replacing its
+// content template when not empty. The templates are tried on an empty item
+// so unknown fields are reported at startup rather than per post.
+func NewItemFormat(preset, contentTemplate string) (*ItemFormat, error) {
+	p, ok := contentPresets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q, expected one of %s", preset, strings.Join(presetNames(), ", "))
+	}
+	if contentTemplate != "" {
+		p.Content = contentTemplate
+	}
+	content, err := template.New("content").Funcs(templateFuncs).Parse(p.Content)
+	if err != nil {
+		return nil, err
+	}
+	note, err := template.New("note").Funcs(templateFuncs).Parse(p.Note)
+	if err != nil {
+		return nil, err
+	}
+	f := &ItemFormat{content: content, note: note}
+	if _, _, err := f.Render(itemData{}); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Render executes the templates for one item
+func (f *ItemFormat) Render(data itemData) (content, note string, err error) {
+	var b strings.Builder
+	if err := f.content.Execute(&b, data); err != nil {
+		return "", "", err
+	}
+	content = b.String()
+	b.Reset()
+	if err := f.note.Execute(&b, data); err != nil {
+		return "", "", err
+	}
+	return content, b.String(), nil
+}
+
+// defaultFormat renders items when no format was configured
+var defaultFormat = func() *ItemFormat {
+	f, err := NewItemFormat(PresetDefault, "")
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
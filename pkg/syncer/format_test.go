@@ -0,0 +1,48 @@
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestContentTemplate(t *testing.T) {
+	post := reddit.Post{ID: "p1", Title: "A [draft] post", Author: "bob", Subreddit: "golang",
+		Permalink: "/r/golang/comments/p1/a_post/", Created: 1707138000}
+	cfg := testConfig(t, map[string]string{
+		"CONTENT_TEMPLATE": `{{if .IsComment}}Comment{{else}}{{mdlink .Title .Permalink}}{{end}} by {{.Author}} in {{tag .Subreddit}} on {{.CreatedTime.Format "2006-01-02"}}`,
+	})
+
+	content, note := buildItem(post, cfg)
+	want := "[A \\[draft\\] post](https://reddit.com/r/golang/comments/p1/a_post/) by bob in #golang on 2024-02-05"
+	if content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+	// The note still comes from the preset
+	if note != "A [draft] post - https://reddit.com/r/golang/comments/p1/a_post/" {
+		t.Errorf("note = %q, want the default preset's", note)
+	}
+}
+
+func TestContentTemplateFallback(t *testing.T) {
+	post := reddit.Post{ID: "p1", Title: "A post", Author: "bob", Subreddit: "golang", Permalink: "/r/golang/comments/p1/a_post/"}
+	for _, tmpl := range []string{`{{.Title`, `{{.NoSuchField}}`, `{{nosuchfunc .Title}}`} {
+		t.Run(tmpl, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"CONTENT_PRESET": PresetTitle, "CONTENT_TEMPLATE": tmpl})
+			if content, _ := buildItem(post, cfg); content != "A post" {
+				t.Errorf("content = %q, want the title preset's content", content)
+			}
+		})
+	}
+
+	// An unknown preset has no built-in format to fall back to
+	t.Setenv("REDDIT_CLIENT_ID", "test-client")
+	t.Setenv("REDDIT_USERNAME", "alice")
+	t.Setenv("DYNALIST_API_KEY", "test-token")
+	t.Setenv("CONTENT_PRESET", "fancy")
+	t.Setenv("CONTENT_TEMPLATE", `{{.Title`)
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), `unknown preset "fancy"`) {
+		t.Errorf("LoadConfig error = %v, want the unknown CONTENT_PRESET rejected", err)
+	}
+}
@@ -0,0 +1,68 @@
+package syncer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values of the GROUP_BY setting
+const (
+	GroupNone  = "none"
+	GroupDay   = "day"
+	GroupWeek  = "week"
+	GroupMonth = "month"
+)
+
+// Placeholders DATE_HEADING_FORMAT accepts in addition to the Go time layout
+const (
+	headingWeekPlaceholder = "{week}"
+	headingYearPlaceholder = "{isoyear}"
+)
+
+// defaultHeadingFormats are used when DATE_HEADING_FORMAT is not set
+var defaultHeadingFormats = map[string]string{
+	GroupDay:   "2006-01-02",
+	GroupWeek:  "{isoyear}-W{week}",
+	GroupMonth: "January 2006",
+}
+
+// periodStart returns the start of the day, ISO week (Monday) or month t
+// falls into, in t's location
+func periodStart(groupBy string, t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch groupBy {
+	case GroupWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case GroupMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// periodHeading returns the heading of the group t falls into, or "" when
+// items aren't grouped. The heading is rendered from the start of the
+// period, so "Monday, January 2" names a week by its Monday.
+func periodHeading(groupBy, format string, t time.Time, loc *time.Location) string {
+	if groupBy == GroupNone || groupBy == "" {
+		return ""
+	}
+	if format == "" {
+		format = defaultHeadingFormats[groupBy]
+	}
+	return renderHeading(format, periodStart(groupBy, t.In(loc)))
+}
+
+// renderHeading formats a date heading. format is a Go time layout such as
+// "2006-01-02" or "Monday, January 2"; {week} and {isoyear} are replaced
+// with the ISO week number and its year, which the layout can't express.
+func renderHeading(format string, t time.Time) string {
+	year, week := t.ISOWeek()
+	format = strings.ReplaceAll(format, headingWeekPlaceholder, "\x00w")
+	format = strings.ReplaceAll(format, headingYearPlaceholder, "\x00y")
+	heading := t.Format(format)
+	heading = strings.ReplaceAll(heading, "\x00w", strconv.Itoa(week))
+	return strings.ReplaceAll(heading, "\x00y", strconv.Itoa(year))
+}
@@ -0,0 +1,75 @@
+package syncer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/internal/cassette"
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// testConfig loads the configuration from the required settings plus env
+func testConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	t.Setenv("REDDIT_CLIENT_ID", "test-client")
+	t.Setenv("REDDIT_USERNAME", "alice")
+	t.Setenv("DYNALIST_API_KEY", "test-token")
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// newTestReddit returns a Reddit client whose token requests are answered
+// with a fixed access token and whose API requests go to handler
+func newTestReddit(t *testing.T, handler http.HandlerFunc) *reddit.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"test-access","token_type":"bearer","expires_in":3600}`)
+	})
+	mux.HandleFunc("/", handler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := reddit.NewClient("test-client", "test-refresh", http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+	return client
+}
+
+// newCassetteReddit returns a Reddit client replaying a cassette in testdata
+func newCassetteReddit(t *testing.T, name string) *reddit.Client {
+	t.Helper()
+	srv := cassette.Replay(t, "testdata/"+name)
+	client, err := reddit.NewClient("test-client", cassette.Redacted, http.DefaultTransport, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.BaseURL = srv.URL
+	client.SetAuthBaseURL(srv.URL)
+	return client
+}
+
+// newTestDynalist returns a Dynalist client whose requests go to handler
+func newTestDynalist(t *testing.T, handler http.HandlerFunc) *dynalist.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := dynalist.NewClient("test-token")
+	client.BaseURL = srv.URL
+	client.Retries = 0
+	return client
+}
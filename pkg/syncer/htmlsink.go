@@ -0,0 +1,194 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const htmlSinkName = "html"
+
+var htmlPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Saved on Reddit</title>
+</head>
+<body>
+<h1>Saved on Reddit</h1>
+<p>Updated {{.Updated.Format "2006-01-02 15:04 MST"}}</p>
+{{range .Groups}}
+<h2>{{if .Subreddit}}r/{{.Subreddit}}{{else}}Other{{end}}</h2>
+<ul>
+{{range .Links}}<li><a href="{{.Link}}">{{.Title}}</a> <small>{{.Seen.Format "2006-01-02"}}</small></li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// htmlHistorySuffix names the file next to the page that lists every post
+// on it, e.g. index.html.json
+const htmlHistorySuffix = ".json"
+
+// HTMLSink renders every post it was given into a static HTML page. The
+// posts are kept in a history file next to the page rather than read from
+// the cache, which forgets them after CACHE_TTL.
+type HTMLSink struct {
+	Filename string
+
+	pending []htmlLink
+}
+
+// htmlLink is a post on the page, as kept in the history file
+type htmlLink struct {
+	ID        string    `json:"id,omitempty"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Subreddit string    `json:"subreddit,omitempty"`
+	Seen      time.Time `json:"seen"`
+}
+
+type htmlGroup struct {
+	Subreddit string
+	Links     []htmlLink
+}
+
+// Name implements Sink
+func (s *HTMLSink) Name() string { return htmlSinkName }
+
+// Add implements Sink. The item is written to the history and the page in
+// Finish.
+func (s *HTMLSink) Add(ctx context.Context, item Item) error {
+	s.pending = append(s.pending, htmlLink{
+		ID:        item.Post.FullID,
+		Title:     postTitle(item.Post),
+		Link:      item.Post.PermalinkURL(),
+		Subreddit: item.Post.Subreddit,
+		Seen:      time.Now(),
+	})
+	return nil
+}
+
+// Finish adds the items queued since the last call to the history and
+// regenerates the page from it. If the history can't be written, the items
+// are removed from the cache so the next cycle tries again.
+func (s *HTMLSink) Finish(ctx context.Context, cache *Cache, name string) error {
+	pending := s.pending
+	s.pending = nil
+	links, err := s.history(cache, name)
+	if err == nil {
+		links = mergeLinks(links, pending)
+		err = s.saveHistory(ctx, links)
+	}
+	if err != nil {
+		for _, link := range pending {
+			cache.Unmark(link.ID, name)
+		}
+		return err
+	}
+	return s.render(links)
+}
+
+// history returns the posts on the page. Without a history file, e.g. on
+// the first run after an upgrade, it starts from the cached deliveries.
+func (s *HTMLSink) history(cache *Cache, name string) ([]htmlLink, error) {
+	data, err := os.ReadFile(s.Filename + htmlHistorySuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		var links []htmlLink
+		for _, entry := range cache.DeliveredEntries(name) {
+			if entry.Link != "" {
+				links = append(links, htmlLink{Title: entry.Title, Link: entry.Link, Subreddit: entry.Subreddit, Seen: entry.Seen})
+			}
+		}
+		return links, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTML history: %w", err)
+	}
+	var links []htmlLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("failed to decode HTML history: %w", err)
+	}
+	return links, nil
+}
+
+// mergeLinks appends the links of added not yet in links, e.g. after
+// DEDUP_TTL let a post be delivered again
+func mergeLinks(links, added []htmlLink) []htmlLink {
+	seen := make(map[string]bool, len(links))
+	for _, link := range links {
+		seen[link.Link] = true
+	}
+	for _, link := range added {
+		if !seen[link.Link] {
+			seen[link.Link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// saveHistory replaces the history file with links
+func (s *HTMLSink) saveHistory(ctx context.Context, links []htmlLink) error {
+	data, err := json.Marshal(links)
+	if err != nil {
+		return fmt.Errorf("failed to encode HTML history: %w", err)
+	}
+	if err := writeFileAtomic(ctx, s.Filename+htmlHistorySuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write HTML history: %w", err)
+	}
+	return nil
+}
+
+// render writes the page listing links grouped by subreddit
+func (s *HTMLSink) render(links []htmlLink) error {
+	groups := make(map[string]*htmlGroup)
+	for _, link := range links {
+		key := strings.ToLower(link.Subreddit)
+		g, ok := groups[key]
+		if !ok {
+			g = &htmlGroup{Subreddit: link.Subreddit}
+			groups[key] = g
+		}
+		g.Links = append(g.Links, link)
+	}
+
+	var sorted []*htmlGroup
+	for _, g := range groups {
+		sort.Slice(g.Links, func(i, j int) bool { return g.Links[i].Seen.After(g.Links[j].Seen) })
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Subreddit) < strings.ToLower(sorted[j].Subreddit)
+	})
+
+	// Render to a temp file and rename it so readers never see a partial page
+	tmp, err := os.CreateTemp(filepath.Dir(s.Filename), ".index-*.html")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	data := struct {
+		Updated time.Time
+		Groups  []*htmlGroup
+	}{time.Now(), sorted}
+	if err := htmlPage.Execute(tmp, data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to render HTML: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write HTML: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to chmod HTML: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.Filename)
+}
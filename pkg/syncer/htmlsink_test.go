@@ -0,0 +1,89 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// deliverHTML runs one cycle of the sink for post like RunCycle does
+func deliverHTML(t *testing.T, sink *HTMLSink, cache *Cache, post reddit.Post) error {
+	t.Helper()
+	if err := sink.Add(context.Background(), Item{Post: post}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	cache.MarkDelivered(post.FullID, sink.Name(), time.Now())
+	cache.Describe(post.FullID, postTitle(post), post.PermalinkURL(), post.Subreddit)
+	return sink.Finish(context.Background(), cache, sink.Name())
+}
+
+func TestHTMLSinkOutlivesCacheTTL(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "index.html")
+	sink := &HTMLSink{Filename: page}
+	cache := NewCache()
+	old := reddit.Post{ID: "p1", FullID: "t3_p1", Title: "Old post", Subreddit: "golang", Permalink: "/r/golang/comments/p1/old/"}
+	if err := deliverHTML(t, sink, cache, old); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	// CACHE_TTL passes and the entry is pruned before the next delivery
+	if n, _ := cache.Cleanup(context.Background(), time.Hour, time.Now().Add(2*time.Hour)); n != 1 {
+		t.Fatalf("Cleanup removed %d entries, want 1", n)
+	}
+	recent := reddit.Post{ID: "p2", FullID: "t3_p2", Title: "New post", Subreddit: "rust", Permalink: "/r/rust/comments/p2/new/"}
+	if err := deliverHTML(t, sink, cache, recent); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	data, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Old post", "r/golang", "New post", "r/rust"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page misses %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestHTMLSinkStartsFromCache(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "index.html")
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", htmlSinkName, time.Now())
+	cache.Describe("t3_p1", "Cached post", "https://reddit.com/comments/p1/", "golang")
+
+	sink := &HTMLSink{Filename: page}
+	post := reddit.Post{ID: "p2", FullID: "t3_p2", Title: "New post", Subreddit: "golang", Permalink: "/r/golang/comments/p2/new/"}
+	if err := deliverHTML(t, sink, cache, post); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	links, err := sink.history(cache, htmlSinkName)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(links) != 2 {
+		t.Errorf("history has %d posts, want the cached and the new one: %+v", len(links), links)
+	}
+}
+
+func TestHTMLSinkFailedHistoryRetries(t *testing.T) {
+	// A directory where the history file should be can't be replaced
+	page := filepath.Join(t.TempDir(), "index.html")
+	if err := os.Mkdir(page+htmlHistorySuffix, 0755); err != nil {
+		t.Fatal(err)
+	}
+	sink := &HTMLSink{Filename: page}
+	cache := NewCache()
+	post := reddit.Post{ID: "p1", FullID: "t3_p1", Title: "Post", Permalink: "/r/golang/comments/p1/post/"}
+	if err := deliverHTML(t, sink, cache, post); err == nil {
+		t.Fatal("Finish succeeded without writing the history")
+	}
+	if cache.IsDelivered("t3_p1", htmlSinkName) {
+		t.Error("post stayed delivered although the history wasn't written")
+	}
+}
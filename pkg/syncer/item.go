@@ -0,0 +1,123 @@
+package syncer
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// postStats describes the popularity of a post when it was fetched, e.g.
+// "↑1234, 56 comments", or just the score for comments
+func postStats(post reddit.Post) string {
+	stats := fmt.Sprintf("↑%d", post.Score)
+	if post.NumComments != nil {
+		if *post.NumComments == 1 {
+			stats += ", 1 comment"
+		} else {
+			stats += fmt.Sprintf(", %d comments", *post.NumComments)
+		}
+	}
+	return stats
+}
+
+// postTitle returns a short human-readable title for a post
+func postTitle(post reddit.Post) string {
+	if post.IsComment {
+		return "Comment by " + post.Author
+	}
+	if post.Title != "" {
+		return post.Title
+	}
+	return "Post by " + post.Author
+}
+
+// previewText returns the self text or comment body the preview is cut from
+func previewText(post reddit.Post, cfg *Config) string {
+	text := post.Selftext + post.Body
+	if cfg.PreviewStripLinks {
+		text = stripMarkdownLinks(text)
+	}
+	return text
+}
+
+// buildItem returns the Dynalist content and note for a saved post
+func buildItem(post reddit.Post, cfg *Config) (content, note string) {
+	data := itemData{
+		Kind:      "post",
+		Title:     postTitle(post),
+		Author:    post.Author,
+		Subreddit: post.Subreddit,
+		Link:      post.PermalinkURL(),
+		Permalink: post.PermalinkURL(),
+		URL:       post.URL,
+		Preview:   textPreview(previewText(post, cfg), cfg.PreviewLength),
+		Created:   post.CreatedTime(),
+		Source:    post.Source,
+		Score:     post.Score,
+		Stats:     postStats(post),
+	}
+	if post.NumComments != nil {
+		data.NumComments = *post.NumComments
+	}
+	if post.IsComment {
+		data.Kind = "comment"
+		data.IsComment = true
+		data.Link, data.SecondaryLink = commentLinks(post, cfg.CommentLink)
+	} else if external := post.ExternalURL(); external != "" && cfg.LinkPostLink == LinkPostURL {
+		data.Link, data.SecondaryLink = external, data.Link
+	}
+	data.MediaLink = data.Link
+	if cfg.DirectVideoLink {
+		if video, ok := post.VideoURL(); ok {
+			data.MediaLink = video
+		}
+	}
+	format := cfg.Format
+	if format == nil {
+		format = defaultFormat
+	}
+	content, note, err := format.Render(data)
+	if err != nil {
+		slog.Warn("Failed to render the configured template, using the default", "post_id", post.FullID, "error", err)
+		content, note, _ = defaultFormat.Render(data)
+	}
+	if post.Source == reddit.ListingUpvoted {
+		// Tells upvoted posts apart from saved ones whatever the template
+		content += " " + metadataTags([]MetadataPair{{Key: reddit.ListingUpvoted}})
+	}
+	if cfg.CreatedFormat != "" {
+		created := "Posted " + data.Created.In(cfg.Location).Format(cfg.CreatedFormat)
+		note = strings.TrimPrefix(note+"\n"+created, "\n")
+	}
+	if cfg.ShowStats {
+		note = strings.TrimPrefix(note+"\n("+data.Stats+")", "\n")
+	}
+	if tags := metadataTags(cfg.StaticMetadata); tags != "" {
+		if cfg.StaticMetadataTarget == MetadataInNote {
+			note = strings.TrimPrefix(note+"\n"+tags, "\n")
+		} else {
+			content += " " + tags
+		}
+	}
+	if fitted, fittedNote, ok := fitContent(content, note, cfg.MaxContentLength, cfg.ContentOverflow); ok {
+		slog.Info("Content exceeds MAX_CONTENT_LENGTH, shortened", "post_id", post.FullID, "max", cfg.MaxContentLength)
+		content, note = fitted, fittedNote
+	}
+	return content, note
+}
+
+// commentLinks returns the primary and secondary link for a saved comment.
+// secondary is empty when only the comment permalink is known.
+func commentLinks(post reddit.Post, mode string) (primary, secondary string) {
+	comment := post.PermalinkURL()
+	submission := post.SubmissionURL()
+	if submission == "" {
+		return comment, ""
+	}
+	if mode == CommentLinkSubmission {
+		return submission, comment
+	}
+	return comment, submission
+}
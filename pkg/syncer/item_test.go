@@ -0,0 +1,143 @@
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestBuildItemSubredditPrefix(t *testing.T) {
+	cfg := testConfig(t, nil)
+	tests := []struct {
+		name  string
+		post  reddit.Post
+		title string
+		want  string // content
+	}{
+		{
+			"post",
+			reddit.Post{ID: "p1", Title: "A post", Author: "bob", Subreddit: "golang", Permalink: "/r/golang/comments/p1/a_post/"},
+			"A post",
+			"[r/golang] Post by bob - https://reddit.com/r/golang/comments/p1/a_post/",
+		},
+		{
+			"untitled post",
+			reddit.Post{ID: "p2", Author: "bob", Subreddit: "golang", Permalink: "/r/golang/comments/p2/"},
+			"Post by bob",
+			"[r/golang] Post by bob - https://reddit.com/r/golang/comments/p2/",
+		},
+		{
+			"comment",
+			reddit.Post{ID: "c1", IsComment: true, Author: "carol", Subreddit: "golang", LinkID: "t3_p1", Permalink: "/r/golang/comments/p1/a_post/c1/"},
+			"Comment by carol",
+			"[r/golang] Post by carol - https://reddit.com/r/golang/comments/p1/a_post/c1/",
+		},
+	}
+	for _, tt := range tests {
+		if got := postTitle(tt.post); got != tt.title {
+			t.Errorf("%s: postTitle() = %q, want %q", tt.name, got, tt.title)
+		}
+		content, note := buildItem(tt.post, cfg)
+		if content != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.name, content, tt.want)
+		}
+		if !strings.HasPrefix(note, tt.title+" - ") {
+			t.Errorf("%s: note = %q, want it to start with the title", tt.name, note)
+		}
+	}
+}
+
+func TestPostStats(t *testing.T) {
+	one, many := 1, 56
+	tests := []struct {
+		name string
+		post reddit.Post
+		want string
+	}{
+		{"post", reddit.Post{Score: 1234, NumComments: &many}, "↑1234, 56 comments"},
+		{"single comment", reddit.Post{Score: 3, NumComments: &one}, "↑3, 1 comment"},
+		{"comment without num_comments", reddit.Post{Score: 7, IsComment: true}, "↑7"},
+	}
+	for _, tt := range tests {
+		if got := postStats(tt.post); got != tt.want {
+			t.Errorf("%s: postStats() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildItemShowStats(t *testing.T) {
+	many := 56
+	post := reddit.Post{ID: "p1", Title: "A post", Author: "bob", Subreddit: "golang",
+		Permalink: "/r/golang/comments/p1/a_post/", Score: 1234, NumComments: &many}
+
+	if _, note := buildItem(post, testConfig(t, nil)); strings.Contains(note, "↑") {
+		t.Errorf("note = %q, want no stats without SHOW_STATS", note)
+	}
+	content, note := buildItem(post, testConfig(t, map[string]string{"SHOW_STATS": "true"}))
+	if !strings.HasSuffix(note, "\n(↑1234, 56 comments)") {
+		t.Errorf("note = %q, want it to end with the stats", note)
+	}
+	if strings.Contains(content, "↑") {
+		t.Errorf("content = %q, want the stats only in the note", content)
+	}
+}
+
+func TestBuildItemTitlePreset(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"CONTENT_PRESET": PresetTitle})
+	tests := []struct {
+		name    string
+		post    reddit.Post
+		content string
+		note    string
+	}{
+		{
+			"post",
+			reddit.Post{ID: "p1", Title: "A post", Author: "bob", Subreddit: "golang", Permalink: "/r/golang/comments/p1/a_post/"},
+			"A post",
+			"https://reddit.com/r/golang/comments/p1/a_post/",
+		},
+		{
+			"comment",
+			reddit.Post{ID: "c1", IsComment: true, Author: "carol", Subreddit: "golang", Permalink: "/r/golang/comments/p1/a_post/c1/"},
+			"Comment by carol",
+			"https://reddit.com/r/golang/comments/p1/a_post/c1/",
+		},
+	}
+	for _, tt := range tests {
+		content, note := buildItem(tt.post, cfg)
+		if content != tt.content || note != tt.note {
+			t.Errorf("%s: item = %q / %q, want %q / %q", tt.name, content, note, tt.content, tt.note)
+		}
+	}
+}
+
+func TestBuildItemLinkAndSelfPosts(t *testing.T) {
+	const permalink = "https://reddit.com/r/golang/comments/p1/a_post/"
+	link := reddit.Post{ID: "p1", Title: "A post", Author: "bob", Subreddit: "golang",
+		Permalink: "/r/golang/comments/p1/a_post/", URL: "https://go.dev/blog/article"}
+	self := link
+	self.URL = "https://www.reddit.com/r/golang/comments/p1/a_post/"
+	empty := link
+	empty.URL = ""
+
+	tests := []struct {
+		name         string
+		post         reddit.Post
+		linkPostLink string
+		content      string
+		note         string
+	}{
+		{"link post", link, LinkPostURL, "[r/golang] Post by bob - https://go.dev/blog/article", "A post - https://go.dev/blog/article\n" + permalink},
+		{"link post, permalink first", link, LinkPostPermalink, "[r/golang] Post by bob - " + permalink, "A post - " + permalink},
+		{"self post", self, LinkPostURL, "[r/golang] Post by bob - " + permalink, "A post - " + permalink},
+		{"post without URL", empty, LinkPostURL, "[r/golang] Post by bob - " + permalink, "A post - " + permalink},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, map[string]string{"LINK_POST_LINK": tt.linkPostLink})
+		content, note := buildItem(tt.post, cfg)
+		if content != tt.content || note != tt.note {
+			t.Errorf("%s: item = %q / %q, want %q / %q", tt.name, content, note, tt.content, tt.note)
+		}
+	}
+}
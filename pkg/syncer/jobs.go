@@ -0,0 +1,295 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// defaultInterval is the poll interval used when POLL_INTERVAL is not set
+const defaultInterval = 5 * time.Minute
+
+// minInterval is the shortest poll interval accepted, to avoid hammering
+// the Reddit API by accident
+const minInterval = 30 * time.Second
+
+// parseInterval parses a poll interval, rejecting ones below minInterval
+func parseInterval(s string) (time.Duration, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < minInterval {
+		return 0, fmt.Errorf("must be at least %s", minInterval)
+	}
+	return d, nil
+}
+
+// nextInterval returns base moved by a random amount of at most jitter
+// either way, but never below minInterval
+func nextInterval(base, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return base
+	}
+	d := base - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+	if d < minInterval {
+		return minInterval
+	}
+	return d
+}
+
+// JobSpec is one entry of the SYNC_JOBS list
+type JobSpec struct {
+	Name     string `json:"name"`
+	Source   string `json:"source,omitempty"`
+	Sink     string `json:"sink,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	// Subreddits, when set, restricts the job to these subreddits
+	Subreddits []string `json:"subreddits,omitempty"`
+
+	// Sink destination overrides
+	HTMLFile       string `json:"html_file,omitempty"`
+	MarkdownFile   string `json:"markdown_file,omitempty"`
+	NATSSubject    string `json:"nats_subject,omitempty"`
+	AMQPRoutingKey string `json:"amqp_routing_key,omitempty"`
+}
+
+// SyncJob is a configured job ready to run
+type SyncJob struct {
+	Name     string
+	Cfg      *Config
+	Sink     Sink
+	Interval time.Duration
+}
+
+// accountPrefix starts the cache keys of an additional account's
+// deliveries. Reddit usernames are case-insensitive and never contain "/".
+func accountPrefix(username string) string {
+	return "u/" + strings.ToLower(username) + "/"
+}
+
+// parseJobSpecs decodes and validates the SYNC_JOBS JSON array
+func parseJobSpecs(data string) ([]JobSpec, error) {
+	var specs []JobSpec
+	if err := json.Unmarshal([]byte(data), &specs); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of jobs: %w", err)
+	}
+	names := make(map[string]bool)
+	for i, spec := range specs {
+		if spec.Name == "" || strings.ContainsAny(spec.Name, "/") {
+			return nil, fmt.Errorf("job %d: name must be set and must not contain \"/\"", i)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("job %q: duplicate name", spec.Name)
+		}
+		names[spec.Name] = true
+		if spec.Source != "" && spec.Source != reddit.ListingSaved && spec.Source != reddit.ListingUpvoted {
+			return nil, fmt.Errorf("job %q: unknown source %q", spec.Name, spec.Source)
+		}
+		if spec.Interval != "" {
+			if _, err := parseInterval(spec.Interval); err != nil {
+				return nil, fmt.Errorf("job %q: invalid interval %q: %w", spec.Name, spec.Interval, err)
+			}
+		}
+	}
+	return specs, nil
+}
+
+// BuildJobs creates the jobs of REDDIT_USERNAME and repeats them for every
+// additional account. An account's copy delivers to the same sink but
+// records deliveries under accountPrefix, so the same post saved by two
+// accounts is delivered for each, and the primary account's cache entries
+// stay as they were before accounts were added.
+func BuildJobs(cfg *Config) ([]*SyncJob, error) {
+	jobs, err := buildAccountJobs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	primary := jobs
+	for _, account := range cfg.Accounts {
+		for _, job := range primary {
+			accountCfg := *job.Cfg
+			accountCfg.Username = account.Username
+			accountCfg.RefreshToken = account.RefreshToken
+			name := account.Username
+			if job.Name != "" {
+				name += "/" + job.Name
+			}
+			jobs = append(jobs, &SyncJob{
+				Name:     name,
+				Cfg:      &accountCfg,
+				Sink:     &namespacedSink{Sink: job.Sink, name: accountPrefix(account.Username) + job.Sink.Name()},
+				Interval: job.Interval,
+			})
+		}
+	}
+	return jobs, nil
+}
+
+// buildAccountJobs creates the jobs of one account. Without SYNC_JOBS there
+// is a single unnamed job whose cache entries are not namespaced, and with
+// IMPORT_UPVOTED a second one for upvoted posts delivering to the same sink,
+// so a post both saved and upvoted is delivered once.
+func buildAccountJobs(cfg *Config) ([]*SyncJob, error) {
+	if len(cfg.Jobs) == 0 {
+		sink, err := NewSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		jobs := []*SyncJob{{Cfg: cfg, Sink: sink, Interval: cfg.PollInterval}}
+		if cfg.ImportUpvoted {
+			upvotedCfg := *cfg
+			upvotedCfg.Source = reddit.ListingUpvoted
+			jobs = append(jobs, &SyncJob{Name: reddit.ListingUpvoted, Cfg: &upvotedCfg, Sink: sink, Interval: cfg.PollInterval})
+		}
+		return jobs, nil
+	}
+
+	var jobs []*SyncJob
+	for _, spec := range cfg.Jobs {
+		jobCfg := *cfg
+		if spec.Source != "" {
+			jobCfg.Source = spec.Source
+		}
+		if spec.Sink != "" {
+			jobCfg.Sink = strings.ToLower(spec.Sink)
+		}
+		if spec.HTMLFile != "" {
+			jobCfg.HTMLFile = spec.HTMLFile
+		}
+		if spec.MarkdownFile != "" {
+			jobCfg.MarkdownFile = spec.MarkdownFile
+		}
+		if spec.NATSSubject != "" {
+			jobCfg.NATSSubject = spec.NATSSubject
+		}
+		if spec.AMQPRoutingKey != "" {
+			jobCfg.AMQPRoutingKey = spec.AMQPRoutingKey
+		}
+		if len(spec.Subreddits) > 0 {
+			jobCfg.Subreddits = normalizeSubreddits(spec.Subreddits)
+		}
+		interval := cfg.PollInterval
+		if spec.Interval != "" {
+			interval, _ = parseInterval(spec.Interval)
+		}
+
+		sink, err := NewSink(&jobCfg)
+		if err != nil {
+			CloseJobs(jobs)
+			return nil, fmt.Errorf("job %q: %w", spec.Name, err)
+		}
+		jobs = append(jobs, &SyncJob{
+			Name:     spec.Name,
+			Cfg:      &jobCfg,
+			Sink:     &namespacedSink{Sink: sink, name: spec.Name + "/" + sink.Name()},
+			Interval: interval,
+		})
+	}
+	return jobs, nil
+}
+
+// CloseJobs closes the sinks that hold connections, once each, also when
+// several accounts' jobs wrap the same sink
+func CloseJobs(jobs []*SyncJob) {
+	closed := make(map[Sink]bool)
+	for _, job := range jobs {
+		sink := job.Sink
+		for {
+			ns, ok := sink.(*namespacedSink)
+			if !ok {
+				break
+			}
+			sink = ns.Sink
+		}
+		if closer, ok := sink.(io.Closer); ok && !closed[sink] {
+			closer.Close()
+			closed[sink] = true
+		}
+	}
+}
+
+// RunJobs runs every job on its own schedule until ctx is done, waiting
+// the job's interval, varied by POLL_JITTER, from the start of one cycle to
+// the next. Cycles hold cycleMu, so cycles of different jobs, or triggered
+// over HTTP, never overlap, since they share the cache and Reddit's rate
+// limit.
+func RunJobs(ctx context.Context, jobs []*SyncJob, cycleMu *sync.Mutex, run func(*SyncJob) Summary) {
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *SyncJob) {
+			defer wg.Done()
+			for {
+				timer := time.NewTimer(nextInterval(job.Interval, job.Cfg.PollJitter))
+				cycleMu.Lock()
+				if ctx.Err() != nil {
+					// Shutdown was requested while another job's cycle ran
+					cycleMu.Unlock()
+					timer.Stop()
+					return
+				}
+				run(job)
+				cycleMu.Unlock()
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+		}(job)
+	}
+	wg.Wait()
+	slog.Info("All sync jobs stopped")
+}
+
+// namespacedSink records deliveries under a job-specific cache key, so the
+// same post can be delivered once per job
+type namespacedSink struct {
+	Sink
+	name string
+}
+
+// Name implements Sink
+func (s *namespacedSink) Name() string { return s.name }
+
+// Start forwards to the wrapped sink
+func (s *namespacedSink) Start(ctx context.Context, cache *Cache, name string) error {
+	if starter, ok := s.Sink.(CycleStarter); ok {
+		return starter.Start(ctx, cache, name)
+	}
+	return nil
+}
+
+// Finish forwards to the wrapped sink
+func (s *namespacedSink) Finish(ctx context.Context, cache *Cache, name string) error {
+	if finisher, ok := s.Sink.(CycleFinisher); ok {
+		return finisher.Finish(ctx, cache, name)
+	}
+	return nil
+}
+
+// Recover forwards to the wrapped sink
+func (s *namespacedSink) Recover(ctx context.Context, cache *Cache, name string, depth int) (int, error) {
+	if recoverer, ok := s.Sink.(CacheRecoverer); ok {
+		return recoverer.Recover(ctx, cache, name, depth)
+	}
+	return 0, nil
+}
+
+// Close forwards to the wrapped sink
+func (s *namespacedSink) Close() error {
+	if closer, ok := s.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
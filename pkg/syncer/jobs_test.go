@@ -0,0 +1,233 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestParseJobSpecs(t *testing.T) {
+	tests := []struct {
+		data string
+		ok   bool
+	}{
+		{`[{"name":"saved"},{"name":"feeds","source":"upvoted","interval":"1m"}]`, true},
+		{`{"name":"saved"}`, false},
+		{`[{"name":""}]`, false},
+		{`[{"name":"a/b"}]`, false},
+		{`[{"name":"a"},{"name":"a"}]`, false},
+		{`[{"name":"a","source":"hidden"}]`, false},
+		{`[{"name":"a","interval":"10s"}]`, false},
+	}
+	for _, tt := range tests {
+		if _, err := parseJobSpecs(tt.data); (err == nil) != tt.ok {
+			t.Errorf("parseJobSpecs(%s) error = %v, want ok %v", tt.data, err, tt.ok)
+		}
+	}
+}
+
+func TestBuildJobsNamespacesEachJob(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t, map[string]string{
+		"SINK":          SinkMarkdown,
+		"MARKDOWN_FILE": filepath.Join(dir, "saved.md"),
+		"SYNC_JOBS": fmt.Sprintf(`[{"name":"saved","interval":"5m"},
+			{"name":"feeds","source":"upvoted","interval":"1m","markdown_file":%q}]`, filepath.Join(dir, "feeds.md")),
+	})
+	jobs, err := BuildJobs(cfg)
+	if err != nil {
+		t.Fatalf("BuildJobs: %v", err)
+	}
+	defer CloseJobs(jobs)
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(jobs))
+	}
+	want := []struct {
+		name, sink, source string
+		interval           time.Duration
+	}{
+		{"saved", "saved/markdown", "saved", 5 * time.Minute},
+		{"feeds", "feeds/markdown", "upvoted", time.Minute},
+	}
+	for i, w := range want {
+		job := jobs[i]
+		if job.Name != w.name || job.Sink.Name() != w.sink || job.Cfg.Source != w.source || job.Interval != w.interval {
+			t.Errorf("job %d = %s %s %s %s, want %+v", i, job.Name, job.Sink.Name(), job.Cfg.Source, job.Interval, w)
+		}
+	}
+
+	// The jobs share the cache, but each delivers and starts on its own
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", jobs[0].Sink.Name(), time.Now())
+	cache.SetStarted(listingKey(jobs[0].Cfg, jobs[0].Sink), time.Now())
+	if cache.IsDelivered("t3_p1", jobs[1].Sink.Name()) {
+		t.Error("a delivery of one job counts for the other")
+	}
+	if jobs[0].FirstRunPending(cache) || !jobs[1].FirstRunPending(cache) {
+		t.Error("the first run of one job ended the other's")
+	}
+}
+
+func TestBuildJobsNamespacesAccounts(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"SINK":                   SinkMarkdown,
+		"MARKDOWN_FILE":          filepath.Join(t.TempDir(), "saved.md"),
+		"REDDIT_USERNAME_2":      "AltAccount",
+		"REDDIT_REFRESH_TOKEN_2": "alt-refresh",
+	})
+	jobs, err := BuildJobs(cfg)
+	if err != nil {
+		t.Fatalf("BuildJobs: %v", err)
+	}
+	defer CloseJobs(jobs)
+	if len(jobs) != 2 {
+		t.Fatalf("got %d jobs, want one per account", len(jobs))
+	}
+	primary, alt := jobs[0], jobs[1]
+	// The primary account keeps the keys it had before accounts were added
+	if primary.Sink.Name() != SinkMarkdown || primary.Cfg.Username != "alice" {
+		t.Errorf("primary job = %s for %s, want markdown for alice", primary.Sink.Name(), primary.Cfg.Username)
+	}
+	if alt.Name != "AltAccount" || alt.Sink.Name() != "u/altaccount/markdown" ||
+		alt.Cfg.Username != "AltAccount" || alt.Cfg.RefreshToken != "alt-refresh" {
+		t.Errorf("account job = %s %s for %s, want AltAccount u/altaccount/markdown", alt.Name, alt.Sink.Name(), alt.Cfg.Username)
+	}
+
+	// The same post saved by both accounts is delivered for each
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", primary.Sink.Name(), time.Now())
+	if cache.IsDelivered("t3_p1", alt.Sink.Name()) {
+		t.Error("a delivery for one account counts for the other")
+	}
+	if listingKey(primary.Cfg, primary.Sink) == listingKey(alt.Cfg, alt.Sink) {
+		t.Error("the accounts share a first run and backfill key")
+	}
+}
+
+func TestRunJobsRunsEveryJob(t *testing.T) {
+	jobs := []*SyncJob{
+		{Name: "a", Cfg: &Config{}, Interval: time.Hour},
+		{Name: "b", Cfg: &Config{}, Interval: time.Hour},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	ran := make(map[string]int)
+	var cycleMu sync.Mutex
+	RunJobs(ctx, jobs, &cycleMu, func(job *SyncJob) Summary {
+		mu.Lock()
+		defer mu.Unlock()
+		ran[job.Name]++
+		if len(ran) == len(jobs) {
+			cancel()
+		}
+		return Summary{}
+	})
+	if ran["a"] != 1 || ran["b"] != 1 {
+		t.Errorf("ran = %v, want each job once before its interval", ran)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"90s", 90 * time.Second, true},
+		{"15m", 15 * time.Minute, true},
+		{"30s", 30 * time.Second, true},
+		{"29s", 0, false},
+		{"0", 0, false},
+		{"300", 0, false},
+		{"-5m", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseInterval(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseInterval(%q) = %s, %v, want %s, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+
+	if cfg := testConfig(t, nil); cfg.PollInterval != defaultInterval {
+		t.Errorf("PollInterval = %s without POLL_INTERVAL, want %s", cfg.PollInterval, defaultInterval)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	if got := nextInterval(5*time.Minute, 0); got != 5*time.Minute {
+		t.Errorf("nextInterval without jitter = %s, want 5m", got)
+	}
+	base, jitter := 5*time.Minute, time.Minute
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 1000; i++ {
+		got := nextInterval(base, jitter)
+		if got < base-jitter || got > base+jitter {
+			t.Fatalf("nextInterval(%s, %s) = %s, outside ±jitter", base, jitter, got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Error("nextInterval never varied")
+	}
+	// A jitter larger than the interval never drops below minInterval
+	for i := 0; i < 1000; i++ {
+		if got := nextInterval(time.Minute, time.Hour); got < minInterval || got > time.Minute+time.Hour {
+			t.Fatalf("nextInterval(1m, 1h) = %s, want between %s and 1h1m", got, minInterval)
+		}
+	}
+}
+
+func TestRunJobsStopsPromptly(t *testing.T) {
+	jobs := []*SyncJob{{Name: "a", Cfg: &Config{}, Interval: time.Hour}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var cycleMu sync.Mutex
+	done := make(chan struct{})
+	go func() {
+		RunJobs(ctx, jobs, &cycleMu, func(job *SyncJob) Summary {
+			cancel()
+			return Summary{}
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunJobs still waits for the next cycle after the context was cancelled")
+	}
+}
+
+func TestBuildJobsImportUpvoted(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"IMPORT_UPVOTED": "true"})
+	jobs, err := BuildJobs(cfg)
+	if err != nil {
+		t.Fatalf("BuildJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Cfg.Source != reddit.ListingSaved || jobs[1].Cfg.Source != reddit.ListingUpvoted {
+		t.Fatalf("jobs = %+v, want saved and upvoted", jobs)
+	}
+	// One sink, so a post both saved and upvoted is delivered once, but
+	// each listing has its own first run and backfill
+	if jobs[0].Sink != jobs[1].Sink {
+		t.Error("the upvoted job has a sink of its own")
+	}
+	if listingKey(jobs[0].Cfg, jobs[0].Sink) == listingKey(jobs[1].Cfg, jobs[1].Sink) {
+		t.Error("the listings share their cache key")
+	}
+
+	post := reddit.Post{ID: "p1", Author: "bob", Subreddit: "golang", Permalink: "/r/golang/comments/p1/"}
+	saved, _ := buildItem(post, jobs[0].Cfg)
+	post.Source = reddit.ListingUpvoted
+	upvoted, _ := buildItem(post, jobs[1].Cfg)
+	if upvoted == saved || !strings.HasPrefix(upvoted, saved+" ") || !strings.Contains(upvoted, reddit.ListingUpvoted) {
+		t.Errorf("upvoted content = %q, want the saved content %q tagged upvoted", upvoted, saved)
+	}
+}
@@ -0,0 +1,49 @@
+package syncer
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+		ok   bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{" warn ", slog.LevelWarn, true},
+		{"warning", slog.LevelWarn, true},
+		{"Error", slog.LevelError, true},
+		{"trace", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+
+	cfg := testConfig(t, map[string]string{"LOG_LEVEL": "warn", "LOG_FORMAT": LogFormatJSON})
+	var out bytes.Buffer
+	logger := slog.New(NewLogHandler(&out, cfg.LogLevel, cfg.LogFormat))
+	logger.Info("dropped")
+	logger.Warn("kept", "post_id", "t3_p1")
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("output is not a single JSON record: %q", out.String())
+	}
+	if record["msg"] != "kept" || record["post_id"] != "t3_p1" {
+		t.Errorf("record = %v", record)
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "LOG_LEVEL") {
+		t.Errorf("LoadConfig error = %v, want one naming LOG_LEVEL", err)
+	}
+}
@@ -0,0 +1,44 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const markdownSinkName = "markdown"
+
+// markdownDatePlaceholder in MARKDOWN_FILE is replaced with the current
+// date, giving one file per day
+const markdownDatePlaceholder = "{date}"
+
+// MarkdownSink appends a "- [Title](permalink)" line per post to a file
+type MarkdownSink struct {
+	// Filename may contain {date}, see markdownDatePlaceholder
+	Filename string
+	// Location is the timezone {date} is computed in
+	Location *time.Location
+}
+
+// Name implements Sink
+func (s *MarkdownSink) Name() string { return markdownSinkName }
+
+// Add implements Sink
+func (s *MarkdownSink) Add(ctx context.Context, item Item) error {
+	filename := strings.ReplaceAll(s.Filename, markdownDatePlaceholder, time.Now().In(s.Location).Format("2006-01-02"))
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open Markdown file: %w", err)
+	}
+	line := "- " + markdownLink(postTitle(item.Post), item.Post.PermalinkURL()) + "\n"
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write Markdown file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write Markdown file: %w", err)
+	}
+	return nil
+}
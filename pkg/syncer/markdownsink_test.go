@@ -0,0 +1,35 @@
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+func TestMarkdownSinkAppendsLines(t *testing.T) {
+	dir := t.TempDir()
+	sink := &MarkdownSink{Filename: filepath.Join(dir, "saved-{date}.md"), Location: time.UTC}
+	posts := []reddit.Post{
+		{ID: "p1", FullID: "t3_p1", Title: "A [draft] post", Permalink: "/r/golang/comments/p1/a_post/"},
+		{ID: "c1", FullID: "t1_c1", IsComment: true, Author: "carol", Permalink: "/r/golang/comments/p1/a_post/c1/"},
+	}
+	for _, post := range posts {
+		if err := sink.Add(context.Background(), Item{Post: post}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "saved-"+time.Now().UTC().Format("2006-01-02")+".md"))
+	if err != nil {
+		t.Fatalf("failed to read the day's file: %v", err)
+	}
+	want := "- [A \\[draft\\] post](https://reddit.com/r/golang/comments/p1/a_post/)\n" +
+		"- [Comment by carol](https://reddit.com/r/golang/comments/p1/a_post/c1/)\n"
+	if string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,182 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// PlannedItem is an item a sync cycle would add to Dynalist
+type PlannedItem struct {
+	Post    reddit.Post
+	Content string
+	Note    string
+	Parent  string
+}
+
+// Plan is the read-only result of running a job's decisions against its
+// saved posts, the cache and the document
+type Plan struct {
+	// Job is the name of the job planned, "" for the default one
+	Job string
+	// Sink is the name the job's deliveries are cached under
+	Sink string
+	// Document is the title of the document items go to, "" for the inbox
+	// or a sink other than Dynalist
+	Document string
+	Add      []PlannedItem
+	Present  []reddit.Post // already in the document but not in the cache
+	Cached   int           // already processed according to the cache
+	Skipped  int           // filtered, merged or marked seen instead of added
+	Later    int           // left for a later cycle by CATCHUP_BATCH or PER_SUBREDDIT_LIMIT
+}
+
+// buildPlan decides which posts a cycle of job would add, using the same
+// decisions as RunCycle. doc may be nil when the document does not exist or
+// items don't go to one, in which case only the cache is consulted.
+func buildPlan(posts []reddit.Post, job *SyncJob, cache *Cache, doc *dynalist.Document) *Plan {
+	cfg := job.Cfg
+	plan := &Plan{Job: job.Name, Sink: job.Sink.Name()}
+	parent := ""
+	if inbox := dynalistSink(job.Sink); inbox != nil {
+		parent = periodHeading(inbox.GroupBy, inbox.Heading, time.Now(), inbox.Location)
+		if parent == "" {
+			parent = "inbox"
+		} else {
+			plan.Document = inbox.Document
+		}
+	}
+	filter := newPostFilter(cfg, cache, job.Sink)
+	for _, post := range posts {
+		switch action, _ := filter.decide(&post); action {
+		case actionDeliver:
+		case actionCached:
+			plan.Cached++
+			continue
+		case actionBacklog, actionDeferred:
+			plan.Later++
+			continue
+		default:
+			plan.Skipped++
+			continue
+		}
+		filter.delivered(post)
+		if doc != nil && documentContainsPost(doc, post) {
+			plan.Present = append(plan.Present, post)
+			continue
+		}
+		content, note := buildItem(post, cfg)
+		plan.Add = append(plan.Add, PlannedItem{
+			Post:    post,
+			Content: content,
+			Note:    note,
+			Parent:  parent,
+		})
+	}
+	return plan
+}
+
+// dynalistSink returns the InboxSink sink delivers to, nil if it delivers
+// somewhere else
+func dynalistSink(sink Sink) *InboxSink {
+	for {
+		switch s := sink.(type) {
+		case *InboxSink:
+			return s
+		case *namespacedSink:
+			sink = s.Sink
+		case *dryRunSink:
+			sink = s.Sink
+		default:
+			return nil
+		}
+	}
+}
+
+// documentContainsPost reports whether any node links to the post's permalink
+func documentContainsPost(doc *dynalist.Document, post reddit.Post) bool {
+	link := post.PermalinkURL()
+	for _, node := range doc.Nodes {
+		if strings.Contains(node.Content, link) || strings.Contains(node.Note, link) {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the plan as a human-readable diff
+func (p *Plan) Print(w io.Writer) {
+	job := ""
+	if p.Job != "" {
+		job = fmt.Sprintf(" (job %q)", p.Job)
+	}
+	switch {
+	case p.Document != "":
+		fmt.Fprintf(w, "Plan for Dynalist document %q%s:\n", p.Document, job)
+	case p.Sink == inboxSink:
+		fmt.Fprintf(w, "Plan for the Dynalist inbox%s:\n", job)
+	default:
+		fmt.Fprintf(w, "Plan for sink %q%s:\n", p.Sink, job)
+	}
+	for _, item := range p.Add {
+		if item.Parent != "" {
+			fmt.Fprintf(w, "+ [%s] %s\n", item.Parent, item.Content)
+		} else {
+			fmt.Fprintf(w, "+ %s\n", item.Content)
+		}
+		if item.Note != "" {
+			fmt.Fprintf(w, "      note: %s\n", item.Note)
+		}
+	}
+	for _, post := range p.Present {
+		fmt.Fprintf(w, "= already in document: %s\n", post.PermalinkURL())
+	}
+	fmt.Fprintf(w, "Plan: %d to add, %d already in document, %d already synced, %d skipped, %d left for later cycles.\n",
+		len(p.Add), len(p.Present), p.Cached, p.Skipped, p.Later)
+}
+
+// RunPlan fetches the listing of job through redditClient and reads the
+// document its items go to without writing anything. Items going to the
+// inbox or to other sinks are only compared against the cache, since the
+// inbox's document is unknown.
+func RunPlan(ctx context.Context, redditClient *reddit.Client, job *SyncJob, cache *Cache, w io.Writer) error {
+	cfg := job.Cfg
+	posts, err := redditClient.GetListing(ctx, cfg.Username, cfg.Source, cfg.FetchLimit)
+	if err != nil {
+		return fmt.Errorf("failed to fetch saved posts: %w", err)
+	}
+
+	inbox := dynalistSink(job.Sink)
+	if inbox == nil {
+		buildPlan(posts, job, cache, nil).Print(w)
+		return nil
+	}
+	if inbox.GroupBy == "" || inbox.GroupBy == GroupNone {
+		fmt.Fprintln(w, "Items go to the Dynalist inbox; comparing against the cache only.")
+		buildPlan(posts, job, cache, nil).Print(w)
+		return nil
+	}
+	file, err := inbox.Client.FindDocument(ctx, inbox.Document, inbox.IgnoreCase)
+	var notFound *dynalist.DocumentNotFoundError
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+	var doc *dynalist.Document
+	if notFound != nil {
+		fmt.Fprintf(w, "%v; comparing against the cache only.\n", notFound)
+	} else {
+		doc, err = inbox.Client.ReadDocument(ctx, file.ID)
+		if err != nil {
+			return fmt.Errorf("failed to read Dynalist document: %w", err)
+		}
+	}
+
+	buildPlan(posts, job, cache, doc).Print(w)
+	return nil
+}
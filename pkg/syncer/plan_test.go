@@ -0,0 +1,169 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// planListing is a saved listing of two posts
+const planListing = `{"kind":"Listing","data":{"after":null,"children":[
+	{"kind":"t3","data":{"id":"p1","title":"First","author":"bob","subreddit":"golang","permalink":"/r/golang/comments/p1/first/"}},
+	{"kind":"t3","data":{"id":"p2","title":"Second","author":"bob","subreddit":"golang","permalink":"/r/golang/comments/p2/second/"}}]}}`
+
+// inboxJob is the default job of cfg, delivering through dynalistClient
+func inboxJob(cfg *Config, dynalistClient *dynalist.Client) *SyncJob {
+	return &SyncJob{Cfg: cfg, Sink: &InboxSink{
+		Client:   dynalistClient,
+		GroupBy:  cfg.GroupBy,
+		Heading:  cfg.DateHeadingFormat,
+		Location: cfg.Location,
+		Document: cfg.DynalistDocument,
+	}}
+}
+
+func TestRunPlanInboxUsesCacheOnly(t *testing.T) {
+	cfg := testConfig(t, nil)
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, planListing)
+	})
+	dynalistClient := newTestDynalist(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Dynalist request %s in inbox mode", r.URL.Path)
+	})
+	cache := NewCache()
+	cache.MarkDelivered("t3_p2", inboxSink, cache.Since)
+
+	var out bytes.Buffer
+	if err := RunPlan(context.Background(), redditClient, inboxJob(cfg, dynalistClient), cache, &out); err != nil {
+		t.Fatalf("RunPlan: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Plan for the Dynalist inbox:",
+		"+ [inbox] [r/golang] Post by bob - https://reddit.com/r/golang/comments/p1/first/",
+		"Plan: 1 to add, 0 already in document, 1 already synced, 0 skipped, 0 left for later cycles.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("plan misses %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunPlanGroupedReadsDocument(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"GROUP_BY": GroupDay, "DATE_HEADING_FORMAT": "Today"})
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, planListing)
+	})
+	dynalistClient := newTestDynalist(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/list":
+			io.WriteString(w, `{"_code":"Ok","files":[{"id":"d1","title":"Reddit","type":"document"}]}`)
+		case "/doc/read":
+			io.WriteString(w, `{"_code":"Ok","nodes":[
+				{"id":"root","content":"Reddit","children":["n1"]},
+				{"id":"n1","content":"[First](https://reddit.com/r/golang/comments/p1/first/)"}]}`)
+		default:
+			t.Errorf("unexpected Dynalist request %s", r.URL.Path)
+		}
+	})
+
+	var out bytes.Buffer
+	if err := RunPlan(context.Background(), redditClient, inboxJob(cfg, dynalistClient), NewCache(), &out); err != nil {
+		t.Fatalf("RunPlan: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		`Plan for Dynalist document "Reddit":`,
+		"+ [Today] [r/golang] Post by bob - https://reddit.com/r/golang/comments/p2/second/",
+		"= already in document: https://reddit.com/r/golang/comments/p1/first/",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("plan misses %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildPlanSkipsCachedPosts(t *testing.T) {
+	cfg := testConfig(t, nil)
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", inboxSink, cache.Since)
+	posts := []reddit.Post{
+		{ID: "p1", FullID: "t3_p1", Title: "First", Permalink: "/r/golang/comments/p1/first/"},
+		{ID: "p2", FullID: "t3_p2", Title: "Second", Permalink: "/r/golang/comments/p2/second/"},
+	}
+
+	plan := buildPlan(posts, inboxJob(cfg, nil), cache, &dynalist.Document{})
+	if plan.Cached != 1 || len(plan.Add) != 1 || plan.Add[0].Post.FullID != "t3_p2" {
+		t.Errorf("plan = %+v", plan)
+	}
+	if plan.Document != "" {
+		t.Errorf("Document = %q, want none for the inbox", plan.Document)
+	}
+}
+
+func TestBuildPlanMatchesCycle(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"SUBREDDIT_DENY":      "pics",
+		"PER_SUBREDDIT_LIMIT": "1",
+		"DEDUP_PERMALINK":     "true",
+	})
+	cache := NewCache()
+	cache.SetStarted(listingKey(cfg, &recordingSink{name: inboxSink}), cache.Since)
+	cache.MarkDelivered("t3_old", inboxSink, cache.Since)
+	cache.Describe("t3_old", "Old", "https://reddit.com/r/golang/comments/p1/first/", "golang")
+	posts := []reddit.Post{
+		{ID: "p0", FullID: "t3_p0", Subreddit: "pics", Permalink: "/r/pics/comments/p0/zero/"},
+		{ID: "p1", FullID: "t3_p1", Subreddit: "golang", Permalink: "/r/golang/comments/p1/first/"},
+		{ID: "p2", FullID: "t3_p2", Subreddit: "golang", Permalink: "/r/golang/comments/p2/second/"},
+		{ID: "p3", FullID: "t3_p3", Subreddit: "golang", Permalink: "/r/golang/comments/p3/third/"},
+	}
+
+	plan := buildPlan(posts, inboxJob(cfg, nil), cache, nil)
+	if len(plan.Add) != 1 || plan.Add[0].Post.FullID != "t3_p2" {
+		t.Errorf("plan adds %+v, want only t3_p2", plan.Add)
+	}
+	// t3_p0 is denied and t3_p1 was delivered as t3_old
+	if plan.Skipped != 2 || plan.Later != 1 {
+		t.Errorf("plan = %+v, want 2 skipped and 1 left for later", plan)
+	}
+}
+
+func TestBuildPlanUsesJobSink(t *testing.T) {
+	cfg := testConfig(t, nil)
+	job := &SyncJob{Name: "html", Cfg: cfg, Sink: &namespacedSink{Sink: &HTMLSink{}, name: "jobs/html"}}
+	cache := NewCache()
+	cache.SetStarted(listingKey(cfg, job.Sink), cache.Since)
+	// Delivered to the inbox only, so still new for the job
+	cache.MarkDelivered("t3_p1", inboxSink, cache.Since)
+	cache.MarkDelivered("t3_p2", "jobs/html", cache.Since)
+	posts := []reddit.Post{
+		{ID: "p1", FullID: "t3_p1", Title: "First", Permalink: "/r/golang/comments/p1/first/"},
+		{ID: "p2", FullID: "t3_p2", Title: "Second", Permalink: "/r/golang/comments/p2/second/"},
+	}
+
+	plan := buildPlan(posts, job, cache, nil)
+	if plan.Cached != 1 || len(plan.Add) != 1 || plan.Add[0].Post.FullID != "t3_p1" {
+		t.Errorf("plan = %+v, want t3_p1 added and t3_p2 cached", plan)
+	}
+	var out bytes.Buffer
+	plan.Print(&out)
+	if !strings.HasPrefix(out.String(), `Plan for sink "jobs/html" (job "html"):`) {
+		t.Errorf("plan header:\n%s", out.String())
+	}
+}
+
+func TestBuildPlanFirstRunMarkSeen(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"FIRST_RUN": FirstRunMarkSeen})
+	posts := []reddit.Post{{ID: "p1", FullID: "t3_p1", Permalink: "/r/golang/comments/p1/first/"}}
+
+	plan := buildPlan(posts, inboxJob(cfg, nil), NewCache(), nil)
+	if len(plan.Add) != 0 || plan.Skipped != 1 {
+		t.Errorf("plan = %+v, want the post marked seen on the first run", plan)
+	}
+}
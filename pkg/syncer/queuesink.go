@@ -0,0 +1,153 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// queueMessage is the JSON payload published for each new post
+type queueMessage struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title,omitempty"`
+	Author    string    `json:"author"`
+	Subreddit string    `json:"subreddit,omitempty"`
+	Permalink string    `json:"permalink"`
+	URL       string    `json:"url,omitempty"`
+	Created   time.Time `json:"created"`
+	Content   string    `json:"content"`
+	Note      string    `json:"note,omitempty"`
+	Source    string    `json:"source"`
+}
+
+func newQueueMessage(item Item) ([]byte, error) {
+	post := item.Post
+	kind := "post"
+	if post.IsComment {
+		kind = "comment"
+	}
+	msg := queueMessage{
+		ID:        post.FullID,
+		Kind:      kind,
+		Title:     post.Title,
+		Author:    post.Author,
+		Subreddit: post.Subreddit,
+		Permalink: post.PermalinkURL(),
+		URL:       post.URL,
+		Created:   post.CreatedTime(),
+		Content:   item.Content,
+		Note:      item.Note,
+		Source:    post.Source,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, nil
+}
+
+// NATSSink publishes each new post to a NATS subject
+type NATSSink struct {
+	Conn    *nats.Conn
+	Subject string
+}
+
+// NewNATSSink connects to the NATS server at url
+func NewNATSSink(url, subject string) (*NATSSink, error) {
+	conn, err := nats.Connect(url, nats.Name("reddit2dynalist"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &NATSSink{Conn: conn, Subject: subject}, nil
+}
+
+// Name implements Sink
+func (s *NATSSink) Name() string { return "nats:" + s.Subject }
+
+// Add implements Sink. The connection is flushed after each publish so a
+// failure is reported for the item that caused it.
+func (s *NATSSink) Add(ctx context.Context, item Item) error {
+	data, err := newQueueMessage(item)
+	if err != nil {
+		return err
+	}
+	if err := s.Conn.Publish(s.Subject, data); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := s.Conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush NATS connection: %w", err)
+	}
+	return nil
+}
+
+// Close drains and closes the connection
+func (s *NATSSink) Close() error {
+	return s.Conn.Drain()
+}
+
+// AMQPSink publishes each new post to an AMQP exchange, e.g. on RabbitMQ
+type AMQPSink struct {
+	Conn       *amqp.Connection
+	Channel    *amqp.Channel
+	Exchange   string
+	RoutingKey string
+}
+
+// NewAMQPSink connects to the broker at url and enables publisher confirms
+func NewAMQPSink(url, exchange, routingKey string) (*AMQPSink, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open AMQP channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	return &AMQPSink{Conn: conn, Channel: ch, Exchange: exchange, RoutingKey: routingKey}, nil
+}
+
+// Name implements Sink
+func (s *AMQPSink) Name() string { return "amqp:" + s.Exchange + "/" + s.RoutingKey }
+
+// Add implements Sink. It waits for the broker to confirm the message so a
+// rejected publish is reported for the item that caused it.
+func (s *AMQPSink) Add(ctx context.Context, item Item) error {
+	data, err := newQueueMessage(item)
+	if err != nil {
+		return err
+	}
+	confirm, err := s.Channel.PublishWithDeferredConfirmWithContext(ctx, s.Exchange, s.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    item.Post.FullID,
+		Timestamp:    time.Now(),
+		Body:         data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to AMQP: %w", err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for AMQP confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("AMQP broker rejected the message")
+	}
+	return nil
+}
+
+// Close closes the channel and the connection
+func (s *AMQPSink) Close() error {
+	s.Channel.Close()
+	return s.Conn.Close()
+}
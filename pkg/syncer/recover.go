@@ -0,0 +1,76 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+)
+
+// CacheRecoverer is implemented by sinks that can rebuild delivery records
+// from their destination after the cache was lost
+type CacheRecoverer interface {
+	Recover(ctx context.Context, cache *Cache, name string, depth int) (int, error)
+}
+
+// redditLinkPattern matches the IDs in post and comment links, e.g.
+// /r/golang/comments/abc123/some_title/def456/
+var redditLinkPattern = regexp.MustCompile(`/comments/([a-z0-9]+)(?:/[^/\s)]*/([a-z0-9]+))?`)
+
+// redditIDs returns the fullnames linked from text. When a comment is
+// linked, only comments are returned, since the submission link of a saved
+// comment doesn't mean the submission itself was saved.
+func redditIDs(text string) []string {
+	var posts, comments []string
+	for _, m := range redditLinkPattern.FindAllStringSubmatch(text, -1) {
+		if m[2] != "" {
+			comments = append(comments, "t1_"+m[2])
+		} else {
+			posts = append(posts, "t3_"+m[1])
+		}
+	}
+	if len(comments) > 0 {
+		return comments
+	}
+	return posts
+}
+
+// Recover marks the posts linked from the newest depth items of the
+// sink's document as delivered under name, or from all items when depth is
+// 0. Newest means first in the document, or last when items are appended.
+// Items sent to the inbox can't be recovered, as its document is unknown.
+func (s *InboxSink) Recover(ctx context.Context, cache *Cache, name string, depth int) (int, error) {
+	if s.GroupBy == "" || s.GroupBy == GroupNone {
+		return 0, fmt.Errorf("items go to the Dynalist inbox, not to document %q", s.Document)
+	}
+	file, err := s.Client.FindDocument(ctx, s.Document, s.IgnoreCase)
+	if err != nil {
+		return 0, err
+	}
+	doc, err := s.Client.ReadDocument(ctx, file.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read Dynalist document: %w", err)
+	}
+	nodes := doc.Ordered()
+	if s.Position == dynalist.InsertAppend {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+	now := time.Now()
+	recovered := 0
+	for i, node := range nodes {
+		if depth > 0 && i >= depth {
+			break
+		}
+		for _, id := range redditIDs(node.Content + "\n" + node.Note) {
+			if !cache.IsDelivered(id, name) {
+				cache.MarkDelivered(id, name, now)
+				recovered++
+			}
+		}
+	}
+	return recovered, nil
+}
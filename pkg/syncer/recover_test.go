@@ -0,0 +1,121 @@
+package syncer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+)
+
+// recoverDocument holds a heading with three items, newest first
+func recoverDocument(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/file/list":
+		io.WriteString(w, `{"_code":"Ok","files":[{"id":"d1","title":"Reddit","type":"document"}]}`)
+	case "/doc/read":
+		io.WriteString(w, `{"_code":"Ok","nodes":[
+			{"id":"root","content":"Reddit","children":["h"]},
+			{"id":"h","content":"2024-05-01","children":["n3","n2","n1"]},
+			{"id":"n3","content":"[r/golang] https://reddit.com/r/golang/comments/p3/third/"},
+			{"id":"n2","content":"Comment","note":"https://reddit.com/r/golang/comments/p2/x/c2/"},
+			{"id":"n1","content":"https://reddit.com/r/golang/comments/p1/first/"}]}`)
+	}
+}
+
+func TestRecoverLookback(t *testing.T) {
+	sink := &InboxSink{
+		Client:   newTestDynalist(t, recoverDocument),
+		GroupBy:  GroupDay,
+		Document: "Reddit",
+	}
+	cache := NewCache()
+	// root and the heading count towards the depth like any other item
+	n, err := sink.Recover(context.Background(), cache, inboxSink, 4)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("recovered %d posts, want 2", n)
+	}
+	for id, want := range map[string]bool{"t3_p3": true, "t1_c2": true, "t3_p2": false, "t3_p1": false} {
+		if got := cache.IsDelivered(id, inboxSink); got != want {
+			t.Errorf("IsDelivered(%s) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestRecoverAppendedReadsFromTheEnd(t *testing.T) {
+	sink := &InboxSink{
+		Client:   newTestDynalist(t, recoverDocument),
+		GroupBy:  GroupDay,
+		Document: "Reddit",
+		Position: dynalist.InsertAppend,
+	}
+	cache := NewCache()
+	if _, err := sink.Recover(context.Background(), cache, inboxSink, 1); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if !cache.IsDelivered("t3_p1", inboxSink) || cache.IsDelivered("t3_p3", inboxSink) {
+		t.Error("appended items were not recovered from the end of the document")
+	}
+}
+
+func TestRecoverInboxMode(t *testing.T) {
+	sink := &InboxSink{
+		Client: newTestDynalist(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected Dynalist request %s in inbox mode", r.URL.Path)
+		}),
+		GroupBy:  GroupNone,
+		Document: "Reddit",
+	}
+	if _, err := sink.Recover(context.Background(), NewCache(), inboxSink, 0); err == nil {
+		t.Error("Recover succeeded although items go to the inbox")
+	}
+}
+
+func TestRedditIDs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"[Title](https://reddit.com/r/golang/comments/abc123/some_title/)", []string{"t3_abc123"}},
+		{"https://www.reddit.com/r/golang/comments/abc123/some_title/def456/", []string{"t1_def456"}},
+		{"Comment - https://reddit.com/comments/abc123/_/def456/ - https://reddit.com/comments/abc123/", []string{"t1_def456"}},
+		{"https://old.reddit.com/comments/abc123/", []string{"t3_abc123"}},
+		{"Buy milk", nil},
+		{"https://go.dev/blog/go1.22", nil},
+	}
+	for _, tt := range tests {
+		got := redditIDs(tt.text)
+		if len(got) != len(tt.want) {
+			t.Errorf("redditIDs(%q) = %v, want %v", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("redditIDs(%q) = %v, want %v", tt.text, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRecoverWholeDocument(t *testing.T) {
+	sink := &InboxSink{
+		Client:   newTestDynalist(t, recoverDocument),
+		GroupBy:  GroupDay,
+		Document: "Reddit",
+	}
+	cache := NewCache()
+	cache.MarkDelivered("t3_p1", inboxSink, cache.Since)
+	n, err := sink.Recover(context.Background(), cache, inboxSink, 0)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	// t3_p1 was cached already
+	if n != 2 {
+		t.Errorf("recovered %d posts, want 2", n)
+	}
+}
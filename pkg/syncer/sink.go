@@ -0,0 +1,360 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// Supported values of the SINK setting
+const (
+	SinkDynalist = "dynalist"
+	SinkHTML     = "html"
+	SinkMarkdown = "markdown"
+	SinkNATS     = "nats"
+	SinkAMQP     = "amqp"
+)
+
+// Item is a saved post rendered for delivery
+type Item struct {
+	Post    reddit.Post
+	Content string
+	Note    string
+}
+
+// Sink is a destination new posts are delivered to
+type Sink interface {
+	// Name identifies the sink in cache entries
+	Name() string
+	// Add delivers a single item
+	Add(ctx context.Context, item Item) error
+}
+
+// Supported values of the ON_CONTENT_COLLISION setting
+const (
+	CollisionInsert       = "insert"
+	CollisionSkip         = "skip"
+	CollisionDisambiguate = "disambiguate"
+)
+
+// errContentCollision is returned by Add when an item was skipped because
+// the document already holds an item with the same content
+var errContentCollision = errors.New("an item with the same content already exists")
+
+// CycleStarter is implemented by sinks that prepare state before each
+// cycle. name is the key the sink's deliveries are recorded under.
+type CycleStarter interface {
+	Start(ctx context.Context, cache *Cache, name string) error
+}
+
+// CycleFinisher is implemented by sinks that write their items in batches.
+// Finish is called after each page of posts and at the end of the cycle,
+// once the items have been added to the cache. name is the key the sink's
+// deliveries were recorded under.
+type CycleFinisher interface {
+	Finish(ctx context.Context, cache *Cache, name string) error
+}
+
+// NewSink builds the sink selected by the configuration
+func NewSink(cfg *Config) (Sink, error) {
+	sink, err := newSink(cfg)
+	if err != nil || !cfg.DryRun {
+		return sink, err
+	}
+	return &dryRunSink{Sink: sink}, nil
+}
+
+func newSink(cfg *Config) (Sink, error) {
+	switch cfg.Sink {
+	case SinkDynalist:
+		return &InboxSink{
+			Client:     NewDynalistClient(cfg),
+			Collision:  cfg.OnContentCollision,
+			Position:   cfg.InsertPosition,
+			GroupBy:    cfg.GroupBy,
+			Heading:    cfg.DateHeadingFormat,
+			Document:   cfg.DynalistDocument,
+			IgnoreCase: cfg.DynalistDocumentIgnoreCase,
+			Location:   cfg.Location,
+
+			CreateDocument: cfg.DynalistCreateDocument,
+		}, nil
+	case SinkHTML:
+		return &HTMLSink{Filename: cfg.HTMLFile}, nil
+	case SinkMarkdown:
+		return &MarkdownSink{Filename: cfg.MarkdownFile, Location: cfg.Location}, nil
+	case SinkNATS:
+		return NewNATSSink(cfg.NATSURL, cfg.NATSSubject)
+	case SinkAMQP:
+		return NewAMQPSink(cfg.AMQPURL, cfg.AMQPExchange, cfg.AMQPRoutingKey)
+	default:
+		return nil, fmt.Errorf("unknown sink %q", cfg.Sink)
+	}
+}
+
+// NewDynalistClient creates a Dynalist client including the
+// endpoint, proxy authentication and TLS settings of cfg
+func NewDynalistClient(cfg *Config) *dynalist.Client {
+	d := dynalist.NewClient(cfg.DynalistKey)
+	d.HTTPClient.Transport = NewTransport(cfg.TLSConfig)
+	d.HTTPClient.Timeout = cfg.DynalistHTTPTimeout
+	if cfg.DynalistBaseURL != "" {
+		d.BaseURL = strings.TrimRight(cfg.DynalistBaseURL, "/")
+	}
+	d.Header = cfg.DynalistHeader
+	d.BasicAuthUser = cfg.DynalistBasicAuthUser
+	d.BasicAuthPassword = cfg.DynalistBasicAuthPassword
+	d.Retries = cfg.DynalistRetries
+	d.MinWriteInterval = cfg.DynalistMinWriteInterval
+	return d
+}
+
+// dryRunSink logs the items it is given instead of delivering them. Only
+// Recover is forwarded, since it just reads the destination, so nothing is
+// ever written there.
+type dryRunSink struct {
+	Sink
+}
+
+// Add implements Sink
+func (s *dryRunSink) Add(ctx context.Context, item Item) error {
+	slog.Info("Dry run: would add item", "sink", s.Name(), "post_id", item.Post.FullID,
+		"subreddit", item.Post.Subreddit, "content", item.Content, "note", item.Note)
+	return nil
+}
+
+// Recover forwards to the wrapped sink
+func (s *dryRunSink) Recover(ctx context.Context, cache *Cache, name string, depth int) (int, error) {
+	if recoverer, ok := s.Sink.(CacheRecoverer); ok {
+		return recoverer.Recover(ctx, cache, name, depth)
+	}
+	return 0, nil
+}
+
+// Close forwards to the wrapped sink
+func (s *dryRunSink) Close() error {
+	if closer, ok := s.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// InboxSink adds items to the Dynalist inbox, or under date headings in
+// Document when GroupBy is set
+type InboxSink struct {
+	Client *dynalist.Client
+	// Collision decides what happens when an item's content already exists
+	// in the document, see the Collision* constants. Items sent to the
+	// inbox are never checked.
+	Collision string
+	// Position places items at the top or bottom of the inbox location,
+	// "" keeps the inbox setting
+	Position string
+	// GroupBy is the period of the heading items are added under, GroupNone
+	// or "" sends them to the inbox
+	GroupBy string
+	// Heading is the DATE_HEADING_FORMAT, "" uses the GroupBy default
+	Heading string
+	// Location is the timezone periods are computed in
+	Location *time.Location
+	// Document is the title of the document grouped items are added to and
+	// checked for collisions against
+	Document   string
+	IgnoreCase bool
+	// CreateDocument creates a missing Document at the root when items are
+	// grouped under headings in it
+	CreateDocument bool
+
+	existing map[string]bool
+	doc      *dynalist.Document
+	headings map[string]string // rendered heading -> node ID
+	pending  []pendingInsert
+	created  []createdNode
+	// lastHeading is the heading of the current period, kept in the cache
+	lastHeading string
+}
+
+// createdNode links a delivered post to the Dynalist node created for it
+type createdNode struct {
+	post, node string
+}
+
+// pendingInsert is an item waiting for the batched document edit
+type pendingInsert struct {
+	id     string // fullname of the post
+	change dynalist.Change
+}
+
+// Name implements Sink
+func (s *InboxSink) Name() string { return inboxSink }
+
+// Start reads the current document contents when items are grouped under
+// date headings
+func (s *InboxSink) Start(ctx context.Context, cache *Cache, name string) error {
+	s.existing = nil
+	s.doc = nil
+	s.headings = make(map[string]string)
+	s.pending = nil
+	s.created = nil
+	s.lastHeading = ""
+	grouped := s.GroupBy != "" && s.GroupBy != GroupNone
+	if !grouped {
+		return nil
+	}
+	file, err := s.Client.FindDocument(ctx, s.Document, s.IgnoreCase)
+	var notFound *dynalist.DocumentNotFoundError
+	if err != nil && !errors.As(err, &notFound) || notFound != nil && !s.CreateDocument {
+		// Grouped items need the document to add their heading to
+		return err
+	}
+	if s.Collision != CollisionInsert {
+		s.existing = make(map[string]bool)
+	}
+	if notFound != nil {
+		id, err := s.Client.CreateDocument(ctx, s.Document, "")
+		if err != nil {
+			return fmt.Errorf("failed to create Dynalist document %q: %w", s.Document, err)
+		}
+		slog.Info("Created Dynalist document", "title", s.Document, "file_id", id)
+		s.doc = &dynalist.Document{FileID: id, Title: s.Document}
+		return nil
+	}
+	doc, err := s.Client.ReadDocument(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read Dynalist document: %w", err)
+	}
+	doc.FileID = file.ID
+	s.doc = doc
+	if h, ok := cache.HeadingFor(name); ok && doc.HasNode(h.NodeID) {
+		// Reuse the heading created earlier even if it was since edited or moved
+		s.headings[h.Heading] = h.NodeID
+	}
+	if s.existing != nil {
+		for _, node := range doc.Nodes {
+			s.existing[node.Content] = true
+		}
+	}
+	return nil
+}
+
+// Add implements Sink
+func (s *InboxSink) Add(ctx context.Context, item Item) error {
+	content, ok := resolveCollision(item.Content, s.existing, s.Collision)
+	if !ok {
+		return errContentCollision
+	}
+	heading := periodHeading(s.GroupBy, s.Heading, time.Now(), s.Location)
+	if heading == "" {
+		nodeID, err := s.Client.AddToInbox(ctx, content, item.Note, s.Position)
+		if err != nil {
+			return err
+		}
+		s.created = append(s.created, createdNode{post: item.Post.FullID, node: nodeID})
+	} else {
+		parentID, err := s.headingNode(ctx, heading)
+		if err != nil {
+			return err
+		}
+		// Sent with the other items of the cycle in one request by Finish
+		s.pending = append(s.pending, pendingInsert{
+			id: item.Post.FullID,
+			change: dynalist.Change{
+				Action:   "insert",
+				ParentID: parentID,
+				Index:    dynalist.InsertIndex(s.Position),
+				Content:  content,
+				Note:     item.Note,
+			},
+		})
+	}
+	if s.existing != nil {
+		s.existing[content] = true
+	}
+	return nil
+}
+
+// Finish writes the items queued for the document in a single edit and
+// records the node IDs of all items created since the last call in the
+// cache. If the edit fails, the queued deliveries are removed from the cache
+// so the next cycle tries again.
+func (s *InboxSink) Finish(ctx context.Context, cache *Cache, name string) error {
+	pending, created := s.pending, s.created
+	s.pending, s.created = nil, nil
+	var err error
+	if len(pending) > 0 {
+		changes := make([]dynalist.Change, len(pending))
+		for i, p := range pending {
+			changes[i] = p.change
+		}
+		var ids []string
+		ids, err = s.Client.EditDocument(ctx, s.doc.FileID, changes)
+		if err != nil {
+			for _, p := range pending {
+				cache.Unmark(p.id, name)
+			}
+			err = fmt.Errorf("failed to add %d items to the document: %w", len(pending), err)
+		}
+		// new_node_ids follows the order of the changes
+		for i := 0; i < len(ids) && i < len(pending); i++ {
+			created = append(created, createdNode{post: pending[i].id, node: ids[i]})
+		}
+	}
+	for _, c := range created {
+		cache.SetNode(c.post, name, c.node)
+	}
+	if s.lastHeading != "" {
+		cache.SetHeading(name, s.lastHeading, s.headings[s.lastHeading])
+	}
+	return err
+}
+
+// headingNode finds the top-level node whose content is exactly heading,
+// creating it when missing. New headings are placed like items, according
+// to INSERT_POSITION.
+func (s *InboxSink) headingNode(ctx context.Context, heading string) (string, error) {
+	if s.doc == nil {
+		return "", fmt.Errorf("Dynalist document %q not loaded", s.Document)
+	}
+	s.lastHeading = heading
+	if id, ok := s.headings[heading]; ok {
+		return id, nil
+	}
+	id := s.doc.FindChild("root", heading)
+	if id == "" {
+		var err error
+		id, err = s.Client.InsertItem(ctx, s.doc.FileID, "root", s.Position, heading, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to create heading %q: %w", heading, err)
+		}
+	}
+	s.headings[heading] = id
+	return id, nil
+}
+
+// resolveCollision applies the collision mode to content that may already
+// exist. ok is false when the item should be skipped.
+func resolveCollision(content string, existing map[string]bool, mode string) (string, bool) {
+	if !existing[content] {
+		return content, true
+	}
+	switch mode {
+	case CollisionSkip:
+		return "", false
+	case CollisionDisambiguate:
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s (%d)", content, n)
+			if !existing[candidate] {
+				return candidate, true
+			}
+		}
+	default:
+		return content, true
+	}
+}
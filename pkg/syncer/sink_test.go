@@ -0,0 +1,389 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/dynalist"
+	"github.com/korjavin/reddit2dynalist/pkg/reddit"
+)
+
+// fakeDocument serves a document titled "Reddit" holding nodes and records
+// the changes of every doc/edit request, answering with new node IDs n1,
+// n2 and so on
+type fakeDocument struct {
+	t     *testing.T
+	nodes string
+
+	mu    sync.Mutex
+	edits [][]dynalist.Change
+	next  int
+}
+
+func (f *fakeDocument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/file/list":
+		io.WriteString(w, `{"_code":"Ok","files":[{"id":"d1","title":"Reddit","type":"document"}]}`)
+	case "/doc/read":
+		io.WriteString(w, `{"_code":"Ok","nodes":`+f.nodes+`}`)
+	case "/doc/edit":
+		var req struct {
+			Changes []dynalist.Change `json:"changes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Errorf("failed to decode doc/edit: %v", err)
+		}
+		f.mu.Lock()
+		f.edits = append(f.edits, req.Changes)
+		var ids []string
+		for range req.Changes {
+			f.next++
+			ids = append(ids, fmt.Sprintf("n%d", f.next))
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"_code": "Ok", "new_node_ids": ids})
+	default:
+		f.t.Errorf("unexpected Dynalist request %s", r.URL.Path)
+	}
+}
+
+// newGroupedSink returns a sink grouping by day under the heading "Saved"
+// in the fake document
+func newGroupedSink(t *testing.T, doc *fakeDocument, position string) *InboxSink {
+	return &InboxSink{
+		Client:   newTestDynalist(t, doc.ServeHTTP),
+		GroupBy:  GroupDay,
+		Heading:  "Saved",
+		Document: "Reddit",
+		Position: position,
+		Location: time.UTC,
+	}
+}
+
+// runSink delivers posts through sink in one cycle
+func runSink(t *testing.T, sink *InboxSink, cache *Cache, posts ...reddit.Post) error {
+	t.Helper()
+	ctx := context.Background()
+	if err := sink.Start(ctx, cache, inboxSink); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for _, post := range posts {
+		if err := sink.Add(ctx, Item{Post: post, Content: post.Title}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		cache.MarkDelivered(post.FullID, inboxSink, time.Now())
+	}
+	return sink.Finish(ctx, cache, inboxSink)
+}
+
+func TestInboxSinkIndexUnderHeading(t *testing.T) {
+	// The heading is the second child of root, so a root-relative index
+	// would put items next to it rather than under it
+	nodes := `[
+		{"id":"root","content":"Reddit","children":["old","h"]},
+		{"id":"old","content":"Older"},
+		{"id":"h","content":"Saved","children":["a","b","c"]},
+		{"id":"a","content":"A"},{"id":"b","content":"B"},{"id":"c","content":"C"}]`
+	for position, want := range map[string]int{dynalist.InsertPrepend: 0, dynalist.InsertAppend: -1, "": 0} {
+		doc := &fakeDocument{t: t, nodes: nodes}
+		sink := newGroupedSink(t, doc, position)
+		post := reddit.Post{FullID: "t3_p1", Title: "New"}
+		if err := runSink(t, sink, NewCache(), post); err != nil {
+			t.Fatalf("Finish: %v", err)
+		}
+		if len(doc.edits) != 1 || len(doc.edits[0]) != 1 {
+			t.Fatalf("position %q: edits = %+v, want one insert", position, doc.edits)
+		}
+		change := doc.edits[0][0]
+		if change.ParentID != "h" || change.Index != want {
+			t.Errorf("position %q: inserted under %q at %d, want under h at %d", position, change.ParentID, change.Index, want)
+		}
+	}
+}
+
+func TestNewDynalistClientThroughProxy(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, `{"_code":"Ok","files":[]}`)
+	}))
+	defer srv.Close()
+	cfg := testConfig(t, map[string]string{
+		"DYNALIST_BASE_URL":   srv.URL + "/dynalist/",
+		"DYNALIST_BASIC_AUTH": "proxy:s3cret:with-colon",
+		"DYNALIST_HEADER":     "X-Gateway-Key: abc 123",
+	})
+
+	if err := NewDynalistClient(cfg).VerifyAPIKey(context.Background()); err != nil {
+		t.Fatalf("VerifyAPIKey: %v", err)
+	}
+	if got.URL.Path != "/dynalist/file/list" {
+		t.Errorf("path = %q, want the endpoint under the overridden root", got.URL.Path)
+	}
+	if user, password, ok := got.BasicAuth(); !ok || user != "proxy" || password != "s3cret:with-colon" {
+		t.Errorf("basic auth = %q, %q, %v", user, password, ok)
+	}
+	if v := got.Header.Get("X-Gateway-Key"); v != "abc 123" {
+		t.Errorf("X-Gateway-Key = %q, want abc 123", v)
+	}
+}
+
+func TestNewDynalistClientBaseURL(t *testing.T) {
+	if got := NewDynalistClient(testConfig(t, nil)).BaseURL; got != dynalist.DefaultBaseURL {
+		t.Errorf("BaseURL = %q without DYNALIST_BASE_URL, want %q", got, dynalist.DefaultBaseURL)
+	}
+
+	var edits []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/doc/edit" {
+			t.Errorf("path = %q, want /doc/edit", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		edits = append(edits, body)
+		io.WriteString(w, `{"_code":"Ok","new_node_ids":["n1"]}`)
+	}))
+	defer srv.Close()
+	cfg := testConfig(t, map[string]string{"DYNALIST_BASE_URL": srv.URL + "/"})
+
+	id, err := NewDynalistClient(cfg).InsertItem(context.Background(), "d1", "root", dynalist.InsertAppend, "A post", "a note")
+	if err != nil {
+		t.Fatalf("InsertItem: %v", err)
+	}
+	if id != "n1" || len(edits) != 1 {
+		t.Fatalf("InsertItem = %q after %d requests, want n1 from the local server", id, len(edits))
+	}
+	change := edits[0]["changes"].([]interface{})[0].(map[string]interface{})
+	if edits[0]["file_id"] != "d1" || edits[0]["token"] != "test-token" || change["content"] != "A post" || change["note"] != "a note" {
+		t.Errorf("request = %v", edits[0])
+	}
+}
+
+func TestNewSinkInsertPosition(t *testing.T) {
+	// Without INSERT_POSITION the inbox's own setting applies
+	for position, want := range map[string]interface{}{"": nil, dynalist.InsertPrepend: float64(0), dynalist.InsertAppend: float64(-1)} {
+		t.Run("position="+position, func(t *testing.T) {
+			var index interface{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				index = body["index"]
+				io.WriteString(w, `{"_code":"Ok","node_id":"n1"}`)
+			}))
+			defer srv.Close()
+			env := map[string]string{"DYNALIST_BASE_URL": srv.URL}
+			if position != "" {
+				env["INSERT_POSITION"] = position
+			}
+			sink, err := NewSink(testConfig(t, env))
+			if err != nil {
+				t.Fatalf("NewSink: %v", err)
+			}
+			if err := sink.Add(context.Background(), Item{Post: reddit.Post{FullID: "t3_p1"}, Content: "item"}); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if index != want {
+				t.Errorf("index = %v, want %v", index, want)
+			}
+		})
+	}
+}
+
+func TestInboxSinkBatchesOneEdit(t *testing.T) {
+	doc := &fakeDocument{t: t, nodes: `[
+		{"id":"root","content":"Reddit","children":["h"]},
+		{"id":"h","content":"Saved"}]`}
+	sink := newGroupedSink(t, doc, dynalist.InsertAppend)
+	cache := NewCache()
+	posts := []reddit.Post{{FullID: "t3_p1", Title: "One"}, {FullID: "t3_p2", Title: "Two"}, {FullID: "t3_p3", Title: "Three"}}
+	if err := runSink(t, sink, cache, posts...); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if len(doc.edits) != 1 || len(doc.edits[0]) != len(posts) {
+		t.Fatalf("edits = %+v, want one request with %d changes", doc.edits, len(posts))
+	}
+	for i, change := range doc.edits[0] {
+		if change.Action != "insert" || change.Content != posts[i].Title || change.ParentID != "h" {
+			t.Errorf("change %d = %+v, want %q inserted under h", i, change, posts[i].Title)
+		}
+	}
+}
+
+func TestInboxSinkStoresNodeIDs(t *testing.T) {
+	doc := &fakeDocument{t: t, nodes: `[
+		{"id":"root","content":"Reddit","children":["h"]},
+		{"id":"h","content":"Saved"}]`}
+	sink := newGroupedSink(t, doc, dynalist.InsertPrepend)
+	cache := NewCache()
+	if err := runSink(t, sink, cache, reddit.Post{FullID: "t3_p1", Title: "One"}, reddit.Post{FullID: "t1_c1", Title: "Two"}); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "cache.json")
+	if err := cache.SaveToFile(context.Background(), file); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	loaded, err := LoadCacheFromFile(file)
+	if err != nil {
+		t.Fatalf("LoadCacheFromFile: %v", err)
+	}
+	// fakeDocument answers with n1, n2 in the order of the changes
+	for id, want := range map[string]string{"t3_p1": "n1", "t1_c1": "n2"} {
+		if node, ok := loaded.Node(id, inboxSink); !ok || node != want {
+			t.Errorf("Node(%s) = %q, %v, want %s", id, node, ok, want)
+		}
+	}
+}
+
+func TestInboxSinkHeadingSequencing(t *testing.T) {
+	doc := &fakeDocument{t: t, nodes: `[{"id":"root","content":"Reddit"}]`}
+	sink := newGroupedSink(t, doc, dynalist.InsertPrepend)
+	cache := NewCache()
+	if err := runSink(t, sink, cache, reddit.Post{FullID: "t3_p1", Title: "One"}); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	// The heading is created first, its ID is then the parent of the item
+	if len(doc.edits) != 2 {
+		t.Fatalf("edits = %+v, want the heading, then the item", doc.edits)
+	}
+	if h := doc.edits[0][0]; h.Content != "Saved" || h.ParentID != "root" {
+		t.Errorf("first edit = %+v, want the heading under root", h)
+	}
+	if item := doc.edits[1][0]; item.Content != "One" || item.ParentID != "n1" {
+		t.Errorf("second edit = %+v, want the item under the new heading n1", item)
+	}
+	if h, ok := cache.HeadingFor(inboxSink); !ok || h.NodeID != "n1" || h.Heading != "Saved" {
+		t.Errorf("cached heading = %+v, %v", h, ok)
+	}
+
+	// A later cycle the same day reuses the cached heading, even after it
+	// was renamed in Dynalist
+	doc.nodes = `[{"id":"root","content":"Reddit","children":["n1"]},{"id":"n1","content":"Saved, renamed"}]`
+	doc.edits = nil
+	if err := runSink(t, sink, cache, reddit.Post{FullID: "t3_p2", Title: "Two"}); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if len(doc.edits) != 1 || doc.edits[0][0].ParentID != "n1" {
+		t.Errorf("edits = %+v, want only the item under n1", doc.edits)
+	}
+}
+
+func TestInboxSinkFailedBatchStaysUncached(t *testing.T) {
+	doc := &fakeDocument{t: t, nodes: `[
+		{"id":"root","content":"Reddit","children":["h"]},
+		{"id":"h","content":"Saved"}]`}
+	sink := newGroupedSink(t, doc, dynalist.InsertPrepend)
+	sink.Client = newTestDynalist(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/doc/edit" {
+			io.WriteString(w, `{"_code":"LockFail","_msg":"Document is locked"}`)
+			return
+		}
+		doc.ServeHTTP(w, r)
+	})
+	cache := NewCache()
+	if err := runSink(t, sink, cache, reddit.Post{FullID: "t3_p1", Title: "One"}, reddit.Post{FullID: "t3_p2", Title: "Two"}); err == nil {
+		t.Fatal("Finish succeeded although doc/edit failed")
+	}
+	for _, id := range []string{"t3_p1", "t3_p2"} {
+		if cache.IsDelivered(id, inboxSink) {
+			t.Errorf("%s is cached although its batch failed", id)
+		}
+	}
+}
+
+func TestDryRunNeverWrites(t *testing.T) {
+	var writes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/list":
+			io.WriteString(w, `{"_code":"Ok","files":[{"id":"d1","title":"Reddit","type":"document"}]}`)
+		case "/doc/read":
+			io.WriteString(w, `{"_code":"Ok","nodes":[{"id":"root","content":"Reddit"}]}`)
+		default:
+			writes = append(writes, r.URL.Path)
+			io.WriteString(w, `{"_code":"Ok","new_node_ids":["n1"],"node_id":"n1","created":["d2"]}`)
+		}
+	}))
+	defer srv.Close()
+	for _, groupBy := range []string{GroupNone, GroupDay} {
+		t.Run(groupBy, func(t *testing.T) {
+			writes = nil
+			cfg := testConfig(t, map[string]string{
+				"DRY_RUN":                  "true",
+				"DYNALIST_BASE_URL":        srv.URL,
+				"GROUP_BY":                 groupBy,
+				"DYNALIST_CREATE_DOCUMENT": "true",
+			})
+			sink, err := NewSink(cfg)
+			if err != nil {
+				t.Fatalf("NewSink: %v", err)
+			}
+			listing := planListing
+			redditClient := serveListing(t, &listing)
+			cache := NewCache()
+			if recoverer, ok := sink.(CacheRecoverer); ok && groupBy != GroupNone {
+				// Seeding from the document only reads it
+				if _, err := recoverer.Recover(context.Background(), cache, sink.Name(), 0); err != nil {
+					t.Fatalf("Recover: %v", err)
+				}
+			}
+
+			summary := RunCycle(context.Background(), redditClient, cfg, sink, cache, filepath.Join(t.TempDir(), "cache.json"))
+			if summary.Err != nil || summary.Added != 2 {
+				t.Errorf("summary = %+v, want 2 posts that would be added", summary)
+			}
+			if len(writes) != 0 {
+				t.Errorf("dry run sent %v", writes)
+			}
+		})
+	}
+}
+
+func TestInboxSinkCreatesMissingDocument(t *testing.T) {
+	doc := &fakeDocument{t: t}
+	var created bool
+	sink := newGroupedSink(t, doc, dynalist.InsertPrepend)
+	sink.CreateDocument = true
+	sink.Client = newTestDynalist(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/list":
+			io.WriteString(w, `{"_code":"Ok","root_file_id":"r","files":[{"id":"r","title":"Root","type":"folder"}]}`)
+		case "/file/edit":
+			created = true
+			io.WriteString(w, `{"_code":"Ok","created":["d2"]}`)
+		case "/doc/edit":
+			var req struct {
+				FileID string `json:"file_id"`
+			}
+			data, _ := io.ReadAll(r.Body)
+			json.Unmarshal(data, &req)
+			if req.FileID != "d2" {
+				t.Errorf("doc/edit of %q, want the created document d2", req.FileID)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			doc.ServeHTTP(w, r)
+		default:
+			t.Errorf("unexpected Dynalist request %s", r.URL.Path)
+		}
+	})
+	if err := runSink(t, sink, NewCache(), reddit.Post{FullID: "t3_p1", Title: "One"}); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if !created {
+		t.Error("the missing document was not created")
+	}
+	if len(doc.edits) != 2 || doc.edits[0][0].Content != "Saved" || doc.edits[1][0].ParentID != "n1" {
+		t.Errorf("edits = %+v, want the heading and then the item in the new document", doc.edits)
+	}
+}
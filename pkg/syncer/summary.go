@@ -0,0 +1,118 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Exit codes returned by -once
+const (
+	ExitAdded      = 0  // the cycle succeeded and added at least one post
+	ExitError      = 1  // fetching failed or at least one item could not be written
+	ExitNoNewPosts = 10 // the cycle succeeded but there was nothing new
+)
+
+// Summary describes the outcome of a single sync cycle
+type Summary struct {
+	// Job is the name of the sync job, empty for REDDIT_USERNAME's job
+	// without SYNC_JOBS
+	Job string `json:"job,omitempty"`
+	// Account is the Reddit account synced, set when several are configured
+	Account  string        `json:"account,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Fetched counts posts not already delivered according to the cache
+	Fetched int `json:"fetched"`
+	// Filtered counts posts dropped by the job's subreddit filter
+	Filtered int `json:"filtered"`
+	Added    int `json:"added"`
+	Failed   int `json:"failed"`
+	// Deferred counts new posts postponed by the per-subreddit limit
+	Deferred int `json:"deferred"`
+	// Merged counts duplicates collapsed into an earlier post of the cycle
+	Merged int `json:"merged"`
+	// Skipped counts items dropped because their content already existed
+	// or, with MISSING_PERMALINK=skip, they had no permalink
+	Skipped int `json:"skipped"`
+	// Backlog counts new posts left for later cycles by CATCHUP_BATCH
+	Backlog int `json:"backlog"`
+	// MarkedSeen counts posts cached without delivery on a first run
+	MarkedSeen int `json:"marked_seen"`
+
+	// RedditCalls and DynalistCalls count the API requests of the cycle
+	RedditCalls   int64 `json:"reddit_calls"`
+	DynalistCalls int64 `json:"dynalist_calls"`
+
+	Err error `json:"-"`
+}
+
+// MarshalJSON adds the error message to the encoded summary
+func (s Summary) MarshalJSON() ([]byte, error) {
+	type plain Summary
+	out := struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain: plain(s)}
+	if s.Err != nil {
+		out.Error = s.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// WriteSummary appends the summary as one line of JSON to path, or writes
+// it to stdout when path is "-"
+func WriteSummary(path string, s Summary) error {
+	line, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+	line = append(line, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(line)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open summary file: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return f.Close()
+}
+
+// ExitCode maps the summary to a process exit code for -once.
+// noNewCode replaces ExitNoNewPosts when nothing new was found.
+func (s Summary) ExitCode(noNewCode int) int {
+	switch {
+	case s.Err != nil || s.Failed > 0:
+		return ExitError
+	case s.Added > 0:
+		return ExitAdded
+	default:
+		return noNewCode
+	}
+}
+
+// Add accumulates the counts of another summary, keeping the first error
+func (s *Summary) Add(o Summary) {
+	s.Fetched += o.Fetched
+	s.Filtered += o.Filtered
+	s.Added += o.Added
+	s.Failed += o.Failed
+	s.Deferred += o.Deferred
+	s.Merged += o.Merged
+	s.Skipped += o.Skipped
+	s.Backlog += o.Backlog
+	s.MarkedSeen += o.MarkedSeen
+	s.RedditCalls += o.RedditCalls
+	s.DynalistCalls += o.DynalistCalls
+	s.Duration += o.Duration
+	if s.Err == nil {
+		s.Err = o.Err
+	}
+}
@@ -0,0 +1,90 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummaryExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary Summary
+		want    int
+	}{
+		{"added", Summary{Added: 2}, ExitAdded},
+		{"nothing new", Summary{Fetched: 3}, 3},
+		{"fetch failed", Summary{Err: errors.New("boom")}, ExitError},
+		{"write failed", Summary{Added: 1, Failed: 1}, ExitError},
+	}
+	for _, tt := range tests {
+		if got := tt.summary.ExitCode(3); got != tt.want {
+			t.Errorf("%s: ExitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunBackfillSingleCycle(t *testing.T) {
+	job := &SyncJob{Cfg: &Config{}, Sink: &recordingSink{name: "test"}}
+	runs := 0
+	summary := RunBackfill(context.Background(), job, NewCache(), func(*SyncJob) Summary {
+		runs++
+		return Summary{Fetched: 1, Added: 1}
+	})
+	if runs != 1 {
+		t.Errorf("ran %d cycles without BACKFILL, want a single pass", runs)
+	}
+	if summary.ExitCode(ExitNoNewPosts) != ExitAdded {
+		t.Errorf("summary = %+v, want the cycle's", summary)
+	}
+}
+
+func TestRunBackfillMultiPage(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"BACKFILL": "true", "CATCHUP_BATCH": "2"})
+	pages := map[string]string{
+		"":      `{"kind":"Listing","data":{"after":"t3_p2","children":[` + postJSON("p1") + `,` + postJSON("p2") + `]}}`,
+		"t3_p2": `{"kind":"Listing","data":{"after":"t3_p4","children":[` + postJSON("p3") + `,` + postJSON("p4") + `]}}`,
+		"t3_p4": `{"kind":"Listing","data":{"after":null,"children":[` + postJSON("p5") + `]}}`,
+	}
+	redditClient := newTestReddit(t, func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Query().Get("after")]
+		if !ok {
+			t.Errorf("unexpected cursor %q", r.URL.Query().Get("after"))
+		}
+		io.WriteString(w, page)
+	})
+	sink := &recordingSink{name: "test"}
+	job := &SyncJob{Cfg: cfg, Sink: sink}
+	cache := NewCache()
+	// Imported before the backfill started
+	cache.MarkDelivered("t3_p3", sink.Name(), time.Now())
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+
+	cycles := 0
+	summary := RunBackfill(context.Background(), job, cache, func(job *SyncJob) Summary {
+		cycles++
+		return RunCycle(context.Background(), redditClient, job.Cfg, job.Sink, cache, cacheFile)
+	})
+	if summary.Err != nil {
+		t.Fatalf("RunBackfill: %v", summary.Err)
+	}
+	if fmt.Sprint(sink.added) != "[t3_p1 t3_p2 t3_p4 t3_p5]" {
+		t.Errorf("added %v, want every uncached post of the three pages once", sink.added)
+	}
+	if cycles < 2 {
+		t.Errorf("ran %d cycles, want CATCHUP_BATCH to spread the backfill over several", cycles)
+	}
+	if state := cache.BackfillFor(listingKey(cfg, sink)); !state.Done {
+		t.Errorf("backfill = %+v, want it done", state)
+	}
+}
+
+// postJSON returns a listing child for a post with the given ID
+func postJSON(id string) string {
+	return fmt.Sprintf(`{"kind":"t3","data":{"id":%q,"title":"Post","subreddit":"golang","permalink":"/r/golang/comments/%s/post/"}}`, id, id)
+}
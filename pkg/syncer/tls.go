@@ -0,0 +1,71 @@
+package syncer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tlsVersions maps TLS_MIN_VERSION values to crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// loadTLSConfig builds the TLS settings of outbound requests from a CA
+// bundle, a client certificate and key, and a minimum version, each of which
+// may be empty. It returns nil when nothing is set, keeping Go's defaults.
+func loadTLSConfig(caFile, certFile, keyFile, minVersion string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && minVersion == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS_CA_FILE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CA_FILE %s contains no PEM certificates", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if minVersion != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(minVersion, "TLS")]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS_MIN_VERSION %q: expected 1.0, 1.1, 1.2 or 1.3", minVersion)
+		}
+		config.MinVersion = version
+	}
+	return config, nil
+}
+
+// NewTransport returns the transport of outbound clients, using tlsConfig
+// when it is not nil
+func NewTransport(tlsConfig *tls.Config) http.RoundTripper {
+	if tlsConfig == nil {
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport
+}
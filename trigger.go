@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// triggerHandler serves POST /sync, which runs a cycle of every job right
+// away and answers with the combined summary as JSON. cycleMu is the lock
+// syncer.RunJobs holds during a cycle; while it is held the request is refused
+// with 409 instead of queueing another cycle. Requests must carry
+// "Authorization: Bearer <token>"; with token empty every request is refused.
+func triggerHandler(token string, cycleMu *sync.Mutex, jobs []*syncer.SyncJob, run func(*syncer.SyncJob) syncer.Summary) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "missing or wrong TRIGGER_TOKEN")
+			return
+		}
+		if !cycleMu.TryLock() {
+			writeJSONError(w, http.StatusConflict, "a sync cycle is already running")
+			return
+		}
+		slog.Info("Sync cycle triggered over HTTP")
+		summary := syncer.Summary{Started: time.Now()}
+		for _, job := range jobs {
+			summary.Add(run(job))
+		}
+		cycleMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if summary.Err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(summary)
+	})
+}
+
+// healthMux serves the health checks, the metrics and, with a trigger token
+// set, POST /sync. The trigger runs cycles on demand, so without a token it
+// is not offered at all.
+func healthMux(health *Health, cache *syncer.Cache, token string, cycleMu *sync.Mutex, jobs []*syncer.SyncJob, run func(*syncer.SyncJob) syncer.Summary) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", health.Handler())
+	mux.Handle("/metrics", metricsHandler(cache))
+	if token != "" {
+		mux.Handle("/sync", triggerHandler(token, cycleMu, jobs, run))
+	}
+	return mux
+}
+
+// writeJSONError answers with status and {"error": msg}
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
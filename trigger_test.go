@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/korjavin/reddit2dynalist/pkg/syncer"
+)
+
+// trigger sends a request to /sync on mux with the given bearer token,
+// none when empty
+func trigger(mux http.Handler, method, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/sync", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTriggerRequiresToken(t *testing.T) {
+	runs := 0
+	jobs := []*syncer.SyncJob{{Name: "a"}, {Name: "b"}}
+	run := func(*syncer.SyncJob) syncer.Summary {
+		runs++
+		return syncer.Summary{Fetched: 2, Added: 1}
+	}
+	var cycleMu sync.Mutex
+
+	// Without TRIGGER_TOKEN the endpoint is not served at all
+	mux := healthMux(&Health{}, syncer.NewCache(), "", &cycleMu, jobs, run)
+	if rec := trigger(mux, http.MethodPost, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("POST /sync without TRIGGER_TOKEN = %d, want 404", rec.Code)
+	}
+
+	mux = healthMux(&Health{}, syncer.NewCache(), "secret", &cycleMu, jobs, run)
+	for _, token := range []string{"", "wrong"} {
+		if rec := trigger(mux, http.MethodPost, token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST /sync with token %q = %d, want 401", token, rec.Code)
+		}
+	}
+	if rec := trigger(mux, http.MethodGet, "secret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /sync = %d, want 405", rec.Code)
+	}
+	if runs != 0 {
+		t.Fatalf("refused requests ran %d cycles", runs)
+	}
+
+	rec := trigger(mux, http.MethodPost, "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /sync = %d %s, want 200", rec.Code, rec.Body)
+	}
+	var summary syncer.Summary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode summary %s: %v", rec.Body, err)
+	}
+	if runs != 2 || summary.Added != 2 {
+		t.Errorf("ran %d jobs, summary %+v, want every job run once and their posts added up", runs, summary)
+	}
+}
+
+func TestTriggerDuringCycle(t *testing.T) {
+	runs := 0
+	run := func(*syncer.SyncJob) syncer.Summary {
+		runs++
+		return syncer.Summary{}
+	}
+	var cycleMu sync.Mutex
+	mux := healthMux(&Health{}, syncer.NewCache(), "secret", &cycleMu, []*syncer.SyncJob{{}}, run)
+
+	// Held by syncer.RunJobs while a scheduled cycle runs
+	cycleMu.Lock()
+	if rec := trigger(mux, http.MethodPost, "secret"); rec.Code != http.StatusConflict {
+		t.Errorf("POST /sync during a cycle = %d, want 409", rec.Code)
+	}
+	if runs != 0 {
+		t.Error("a cycle ran alongside the one in progress")
+	}
+	cycleMu.Unlock()
+
+	if rec := trigger(mux, http.MethodPost, "secret"); rec.Code != http.StatusOK || runs != 1 {
+		t.Errorf("POST /sync after the cycle = %d with %d runs, want 200 and one run", rec.Code, runs)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build information, set with e.g.
+// -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234 -X main.date=2024-08-13"
+// Unset values are taken from the module and VCS data Go embeds.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+// readBuildInfo returns the -ldflags values, falling back to the build
+// information embedded by the Go toolchain
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, Date: date}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String formats the build information for -version
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("reddit2dynalist %s (commit %s, built %s)", b.Version, b.Commit, b.Date)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestReadBuildInfoPrefersLdflags(t *testing.T) {
+	saved := [3]string{version, commit, date}
+	t.Cleanup(func() { version, commit, date = saved[0], saved[1], saved[2] })
+	version, commit, date = "v1.2.0", "abc1234", "2024-08-13"
+
+	want := "reddit2dynalist v1.2.0 (commit abc1234, built 2024-08-13)"
+	if got := readBuildInfo().String(); got != want {
+		t.Errorf("readBuildInfo() = %q, want %q", got, want)
+	}
+}
+
+// TestVersionFlag runs main with -version in a child process that has no
+// configuration, so it can only succeed if the flag exits before loading it
+func TestVersionFlag(t *testing.T) {
+	if os.Getenv("R2D_TEST_VERSION_FLAG") == "1" {
+		os.Args = []string{"reddit2dynalist", "-version"}
+		main()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestVersionFlag$")
+	cmd.Env = []string{"R2D_TEST_VERSION_FLAG=1", "PATH=" + os.Getenv("PATH")}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("main -version failed: %v\n%s", err, out)
+	}
+	if first, _, _ := strings.Cut(string(out), "\n"); first != readBuildInfo().String() {
+		t.Errorf("main -version printed %q, want %q", first, readBuildInfo().String())
+	}
+}